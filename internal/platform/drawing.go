@@ -8,28 +8,28 @@ import (
 	. "github.com/glupi-borna/soko/internal/utils"
 )
 
-func (p *platform) SetColor(c sdl.Color) {
+func (p *Platform_State) SetColor(c sdl.Color) {
 	p.Renderer.SetDrawColor(c.R, c.G, c.B, c.A)
 }
 
-func (p *platform) RawSetFont(font *Font) {
+func (p *Platform_State) RawSetFont(font *Font) {
 	p.Font = font
 }
 
-func (p *platform) SetFont(font_name string, font_size int) {
+func (p *Platform_State) SetFont(font_name string, font_size int) {
 	font := GetFont(font_name, font_size)
 	p.Font = font
 }
 
-func (p *platform) DrawRectOutlined(x, y, w, h float32) {
+func (p *Platform_State) DrawRectOutlined(x, y, w, h float32) {
 	p.Renderer.DrawRectF(&sdl.FRect{x, y, w, h})
 }
 
-func (p *platform) DrawRectFilled(x, y, w, h float32) {
+func (p *Platform_State) DrawRectFilled(x, y, w, h float32) {
 	p.Renderer.FillRectF(&sdl.FRect{x, y, w, h})
 }
 
-func (p *platform) DrawText(text string, x, y float32) {
+func (p *Platform_State) DrawText(text string, x, y float32) {
 	r, g, b, a, _ := p.Renderer.GetDrawColor()
 	c := sdl.Color{r, g, b, a}
 
@@ -112,11 +112,11 @@ func cornerPointsCount(r float32) int {
 	return int(Max(arc_length / MIN_SEGMENT_LENGTH, 2))
 }
 
-func (p *platform) DrawPoints(pts []sdl.FPoint) {
+func (p *Platform_State) DrawPoints(pts []sdl.FPoint) {
 	p.Renderer.DrawPointsF(pts)
 }
 
-func (p *platform) DrawRoundRectOutlined(x, y, w, h, r float32) {
+func (p *Platform_State) DrawRoundRectOutlined(x, y, w, h, r float32) {
 	points := RoundRectPoints(x, y, Max(w-1, 0), Max(h-1, 0), r)
 	p.Renderer.DrawLinesF(points)
 	l := len(points)-1
@@ -125,7 +125,7 @@ func (p *platform) DrawRoundRectOutlined(x, y, w, h, r float32) {
 
 var RRVERTS = make([]sdl.Vertex, 0)
 
-func (p *platform) DrawRoundRectFilled(x, y, w, h, r float32) {
+func (p *Platform_State) DrawRoundRectFilled(x, y, w, h, r float32) {
 	R,G,B,A,_ := p.Renderer.GetDrawColor()
 	c := sdl.Color{R,G,B,A}
 
@@ -154,10 +154,8 @@ func (p *platform) DrawRoundRectFilled(x, y, w, h, r float32) {
 	p.Renderer.RenderGeometry(nil, RRVERTS, nil)
 }
 
-var tex_cache map[string]*sdl.Texture = make(map[string]*sdl.Texture)
-
-func (p *platform) DrawImage(x, y, w, h float32, url string) bool {
-	tex, ok := tex_cache[url]
+func (p *Platform_State) DrawImage(x, y, w, h float32, url string) bool {
+	tex, ok := p.images[url]
 	if !ok {
 		realurl := url
 		if strings.HasPrefix(realurl, "file://") {
@@ -165,7 +163,7 @@ func (p *platform) DrawImage(x, y, w, h float32, url string) bool {
 		}
 
 		tex, err := img.LoadTexture(p.Renderer, realurl)
-		tex_cache[url] = tex
+		p.images[url] = tex
 
 		if err != nil {
 			println(url, err.Error())
@@ -198,8 +196,8 @@ func (p *platform) DrawImage(x, y, w, h float32, url string) bool {
 	return true
 }
 
-func (p *platform) ImageSize(url string) (int32, int32) {
-	tex, ok := tex_cache[url]
+func (p *Platform_State) ImageSize(url string) (int32, int32) {
+	tex, ok := p.images[url]
 	if !ok { return 0, 0 }
 	_, _, w, h, _ := tex.Query()
 	return w, h
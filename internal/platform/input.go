@@ -1,5 +1,11 @@
 package platform
 
+import (
+	"errors"
+	"strings"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
 type BUTTON_STATE uint8
 const (
 	BS_UP BUTTON_STATE = iota
@@ -18,39 +24,205 @@ func ButtonMapUpdate[K comparable](m map[K]BUTTON_STATE) {
 	}
 }
 
-func (p *platform) KeyboardPressed(key uint32) bool {
+func (p *Platform_State) KeyboardPressed(key uint32) bool {
 	state, ok := p.Keyboard[key]
 	if !ok { return false }
 	return state == BS_PRESSED
 }
 
-func (p *platform) KeyboardReleased(key uint32) bool {
+func (p *Platform_State) KeyboardReleased(key uint32) bool {
 	state, ok := p.Keyboard[key]
 	if !ok { return false }
 	return state == BS_RELEASED
 }
 
-func (p *platform) MousePressed(btn uint8) bool {
+func (p *Platform_State) MousePressed(btn uint8) bool {
 	state, ok := p.Mouse[btn]
 	if !ok { return false }
 	return state == BS_PRESSED
 }
 
-func (p *platform) MouseReleased(btn uint8) bool {
+func (p *Platform_State) MouseReleased(btn uint8) bool {
 	state, ok := p.Mouse[btn]
 	if !ok { return false }
 	return state == BS_RELEASED
 }
 
-func (p *platform) MouseDown(btn uint8) bool {
+func (p *Platform_State) MouseDown(btn uint8) bool {
 	state, ok := p.Mouse[btn]
 	if !ok { return false }
 	return state == BS_DOWN
 }
 
-func (p *platform) MouseUp(btn uint8) bool {
+func (p *Platform_State) MouseUp(btn uint8) bool {
 	state, ok := p.Mouse[btn]
 	if !ok { return false }
 	return state == BS_UP
 }
 
+
+func (p *Platform_State) KeyboardDown(key uint32) bool {
+	state, ok := p.Keyboard[key]
+	if !ok { return false }
+	return state == BS_DOWN
+}
+
+// Resets per-frame input state. Should be called once per frame,
+// before events are handled.
+func (p *Platform_State) ResetInput() {
+	ButtonMapUpdate(p.Keyboard)
+	ButtonMapUpdate(p.Mouse)
+	p.AnyKeyPressed = false
+	p.MouseDelta.X = 0
+	p.MouseDelta.Y = 0
+	p.WheelDelta.X = 0
+	p.WheelDelta.Y = 0
+	p.TextInput = ""
+}
+
+// Updates the input state from an SDL event.
+func (p *Platform_State) HandleEvent(event sdl.Event) {
+	switch e := event.(type) {
+
+	case *sdl.MouseButtonEvent:
+		if e.Type == sdl.MOUSEBUTTONDOWN {
+			p.Mouse[e.Button] = BS_PRESSED
+		} else {
+			p.Mouse[e.Button] = BS_RELEASED
+		}
+		p.MousePos.X = float32(e.X)
+		p.MousePos.Y = float32(e.Y)
+
+	case *sdl.MouseWheelEvent:
+		p.WheelDelta.X += float32(e.X)
+		p.WheelDelta.Y += float32(e.Y)
+
+	case *sdl.MouseMotionEvent:
+		p.MousePos.X = float32(e.X)
+		p.MousePos.Y = float32(e.Y)
+		p.MouseDelta.X += float32(e.XRel)
+		p.MouseDelta.Y += float32(e.YRel)
+
+	case *sdl.KeyboardEvent:
+		if e.Type == sdl.KEYDOWN {
+			p.Keyboard[uint32(e.Keysym.Scancode)] = BS_PRESSED
+			p.AnyKeyPressed = true
+		} else {
+			p.Keyboard[uint32(e.Keysym.Scancode)] = BS_RELEASED
+		}
+		p.Modifiers = sdl.Keymod(e.Keysym.Mod)
+
+	case *sdl.TextInputEvent:
+		p.TextInput += e.GetText()
+
+	case *sdl.TextEditingEvent:
+		p.TextComposition = e.GetText()
+		p.TextCompositionCursor = int(e.Start)
+	}
+}
+
+// Tells the input method where the text is being typed,
+// so that it can place its candidate window next to it.
+func (p *Platform_State) SetTextInputRect(x, y, w, h float32) {
+	sdl.SetTextInputRect(&sdl.Rect{X: int32(x), Y: int32(y), W: int32(w), H: int32(h)})
+}
+
+// Returns the text on the clipboard.
+func (p *Platform_State) Clipboard() string {
+	text, err := sdl.GetClipboardText()
+	if err != nil { return "" }
+	return text
+}
+
+func (p *Platform_State) SetClipboard(text string) {
+	err := sdl.SetClipboardText(text)
+	if err != nil { println("SetClipboard():", err.Error()) }
+}
+
+type KeyMod uint8
+const (
+	KM_CTRL KeyMod = 1 << iota
+	KM_SHIFT
+	KM_ALT
+	KM_SUPER
+)
+
+// Collapses SDL's left/right modifier bits into KeyMod flags,
+// ignoring lock modifiers (caps lock, num lock).
+func keyModFromSDL(m sdl.Keymod) KeyMod {
+	var km KeyMod
+	if m & sdl.KMOD_CTRL != 0 { km |= KM_CTRL }
+	if m & sdl.KMOD_SHIFT != 0 { km |= KM_SHIFT }
+	if m & sdl.KMOD_ALT != 0 { km |= KM_ALT }
+	if m & sdl.KMOD_GUI != 0 { km |= KM_SUPER }
+	return km
+}
+
+func (p *Platform_State) KeyMods() KeyMod {
+	return keyModFromSDL(p.Modifiers)
+}
+
+// A key together with the modifiers that have to be held for it,
+// parsed from strings such as "Escape", "Ctrl+K" or "ctrl+shift+tab".
+type KeyCombo struct {
+	Mods KeyMod
+	Key uint32
+}
+
+var keyComboCache = make(map[string]KeyCombo)
+
+func ParseKeyCombo(combo string) (KeyCombo, error) {
+	kc, ok := keyComboCache[combo]
+	if ok { return kc, nil }
+
+	parts := strings.Split(combo, "+")
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+
+		if i < len(parts)-1 {
+			switch strings.ToLower(part) {
+			case "ctrl", "control": kc.Mods |= KM_CTRL
+			case "shift": kc.Mods |= KM_SHIFT
+			case "alt": kc.Mods |= KM_ALT
+			case "super", "gui", "meta", "cmd": kc.Mods |= KM_SUPER
+			default:
+				return kc, errors.New("Unknown modifier '" + part + "' in key combo '" + combo + "'")
+			}
+			continue
+		}
+
+		sc := sdl.GetScancodeFromName(part)
+		if sc == sdl.SCANCODE_UNKNOWN {
+			return kc, errors.New("Unknown key '" + part + "' in key combo '" + combo + "'")
+		}
+		kc.Key = uint32(sc)
+	}
+
+	keyComboCache[combo] = kc
+	return kc, nil
+}
+
+func (p *Platform_State) comboState(combo string, check func(uint32) bool) bool {
+	kc, err := ParseKeyCombo(combo)
+	if err != nil {
+		println(err.Error())
+		return false
+	}
+	return p.KeyMods() == kc.Mods && check(kc.Key)
+}
+
+func (p *Platform_State) ComboPressed(combo string) bool {
+	return p.comboState(combo, p.KeyboardPressed)
+}
+
+func (p *Platform_State) ComboReleased(combo string) bool {
+	return p.comboState(combo, p.KeyboardReleased)
+}
+
+// Returns true while the combo is held, including the frame in which it
+// was pressed.
+func (p *Platform_State) ComboDown(combo string) bool {
+	return p.comboState(combo, func(key uint32) bool {
+		return p.KeyboardPressed(key) || p.KeyboardDown(key)
+	})
+}
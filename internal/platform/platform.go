@@ -58,13 +58,18 @@ func (w *WindowAnchorFlag) Set(val string) error {
 	return nil
 }
 
-var Platform platform
+// The platform state of the window that is currently being
+// updated or rendered.
+var Platform = &Platform_State{}
 
 type PlatformInitOptions struct {
 	Display int
 	X int32
 	Y int32
 	Anchor WindowAnchorFlag
+	// Creates a plain hidden window with a software renderer,
+	// for running without a display (e.g. tests).
+	Headless bool
 }
 
 
@@ -72,29 +77,57 @@ type Font struct {
 	SDLFont *ttf.Font
 	CacheName string
 	Height   float32
+	Name     string
+	Size     int
+	Style    int
 }
 
 var loadedFontCache = lru.New(50, func (f *Font) { f.SDLFont.Close() })
-func loadedFontCacheKey(font_name string, font_size int) string {
-	return font_name + "|" + strconv.Itoa(font_size)
+func loadedFontCacheKey(font_name string, font_size int, style int) string {
+	key := font_name + "|" + strconv.Itoa(font_size)
+	if style != ttf.STYLE_NORMAL { key += "|" + strconv.Itoa(style) }
+	return key
 }
 
 func GetFont(font_name string, font_size int) *Font {
-	key := loadedFontCacheKey(font_name, font_size)
+	key := loadedFontCacheKey(font_name, font_size, ttf.STYLE_NORMAL)
 	font, ok := loadedFontCache.Get(key)
 	if ok { return font }
 
+	font = openFont(font_name, font_size, ttf.STYLE_NORMAL)
+	loadedFontCache.Set(key, font)
+	return font
+}
+
+// Fonts of rich text spans. Their runs keep the fonts from layout
+// until rendering, so these are never evicted (and closed).
+var styledFonts = make(map[string]*Font)
+
+// Returns a font with a combination of the ttf.STYLE_* flags
+// (bold, italic, underline) applied.
+func GetStyledFont(font_name string, font_size int, style int) *Font {
+	key := loadedFontCacheKey(font_name, font_size, style)
+	font, ok := styledFonts[key]
+	if ok { return font }
+
+	font = openFont(font_name, font_size, style)
+	styledFonts[key] = font
+	return font
+}
+
+func openFont(font_name string, font_size int, style int) *Font {
 	ttf_font, err := ttf.OpenFont(GetFontPath(font_name), font_size)
 	Die(err)
+	if style != ttf.STYLE_NORMAL { ttf_font.SetStyle(style) }
 
-	font = &Font{
+	return &Font{
 		SDLFont: ttf_font,
-		CacheName: key,
+		CacheName: loadedFontCacheKey(font_name, font_size, style),
 		Height: float32(font_size),
+		Name: font_name,
+		Size: font_size,
+		Style: style,
 	}
-
-	loadedFontCache.Set(key, font)
-	return font
 }
 
 var fc_lookup = make(map[string]string)
@@ -114,18 +147,27 @@ func GetFontPath(font_name string) string {
 
 type V2i struct { X, Y int32 }
 
-type platform struct {
+// Holds the window, renderer and input state of a single window.
+type Platform_State struct {
 	Window *sdl.Window
 	TargetDisplay int
 	TargetPosition V2i
 	AnchorOffset V2
+	Headless bool
 	Renderer *sdl.Renderer
 	Mouse map[uint8]BUTTON_STATE
 	MousePos V2
 	MouseDelta V2
 	WheelDelta V2
 	Keyboard map[uint32]BUTTON_STATE
+	Modifiers sdl.Keymod
 	AnyKeyPressed bool
+	TextInput string
+	// Text that is being composed with an input method, which is
+	// not part of TextInput until it is committed
+	TextComposition string
+	// Cursor position in TextComposition, in runes
+	TextCompositionCursor int
 
 	Font *Font
 	FontSize float64
@@ -133,10 +175,16 @@ type platform struct {
 
 	shapeSurf *sdl.Surface
 	cornerRadius float32
+
+	// Textures belong to a renderer, so they can't be
+	// shared between windows.
+	fontTextures lru.LRUCache[*sdl.Texture]
+	images map[string]*sdl.Texture
 }
 
-func (p *platform) Init(opts PlatformInitOptions) {
+func (p *Platform_State) Init(opts PlatformInitOptions) {
 	p.TargetDisplay = opts.Display
+	p.Headless = opts.Headless
 	p.TargetPosition = V2i{X: opts.X, Y: opts.Y}
 	p.AnchorOffset = opts.Anchor.V2
 
@@ -158,11 +206,21 @@ func (p *platform) Init(opts PlatformInitOptions) {
 	sdl.SetHint("SDL_X11_FORCE_OVERRIDE_REDIRECT", "1")
 	sdl.SetHint(sdl.HINT_FRAMEBUFFER_ACCELERATION, "0")
 	sdl.SetHint(sdl.HINT_RENDER_SCALE_QUALITY, "1")
+	// Let the input method draw its own candidate window
+	sdl.SetHint("SDL_IME_SHOW_UI", "1")
 	sdl.GLSetAttribute(sdl.GL_MULTISAMPLESAMPLES, 4)
 	sdl.GLSetAttribute(sdl.GL_MULTISAMPLEBUFFERS, 1)
 
-	window, err := sdl.CreateShapedWindow(
-		"", 0, 0, 200, 200, window_flags)
+	var window *sdl.Window
+	var err error
+	if opts.Headless {
+		window, err = sdl.CreateWindow(
+			"", 0, 0, 200, 200, sdl.WINDOW_HIDDEN)
+		renderer_flags = sdl.RENDERER_SOFTWARE | sdl.RENDERER_TARGETTEXTURE
+	} else {
+		window, err = sdl.CreateShapedWindow(
+			"", 0, 0, 200, 200, window_flags)
+	}
 	Die(err)
 	p.Window = window
 
@@ -170,6 +228,9 @@ func (p *platform) Init(opts PlatformInitOptions) {
 	Die(err)
 	p.Renderer = renderer
 
+	p.fontTextures = lru.New(200, func (t *sdl.Texture) { t.Destroy() })
+	p.images = make(map[string]*sdl.Texture)
+
 	p.ResizeWindow(200, 200)
 	p.ReshapeWindow(0, true)
 
@@ -181,24 +242,23 @@ func (p *platform) Init(opts PlatformInitOptions) {
 	p.MousePos.Y = -1
 }
 
-func (p *platform) Cleanup() {
+func (p *Platform_State) Cleanup() {
+	p.Renderer.Destroy()
 	p.Window.Destroy()
-	p.Font.SDLFont.Close()
 }
 
-var fontTextureCache = lru.New(200, func (t *sdl.Texture) { t.Destroy() })
 func fontCacheKey(f *Font, text string, c sdl.Color) string {
 	return f.CacheName + ColStr(c) + "|" + text
 }
 
-func (p *platform) GetTextTexture(f *Font, t string, c sdl.Color) *sdl.Texture {
+func (p *Platform_State) GetTextTexture(f *Font, t string, c sdl.Color) *sdl.Texture {
 	key := fontCacheKey(f, t, c)
-	tex, ok := fontTextureCache.Get(key)
+	tex, ok := p.fontTextures.Get(key)
 	if ok { return tex }
 	surf, _ := f.SDLFont.RenderUTF8Blended(t, c)
 	tex, _ = p.Renderer.CreateTextureFromSurface(surf)
 	surf.Free()
-	fontTextureCache.Set(key, tex)
+	p.fontTextures.Set(key, tex)
 	return tex
 }
 
@@ -207,18 +267,11 @@ func textMetricsCacheKey(f *Font, text string) string {
 	return f.CacheName + "|" + text
 }
 
-func (p *platform) TextMetrics(text string) V2 {
-	key := textMetricsCacheKey(p.Font, text)
-	m, ok := textMetricsCache[key]
-	if !ok {
-		w, h, _ := p.Font.SDLFont.SizeUTF8(text)
-		m = V2{float32(w), float32(h)}
-		textMetricsCache[key] = m
-	}
-	return m
+func (p *Platform_State) TextMetrics(text string) V2 {
+	return p.MeasureText(p.Font, text)
 }
 
-func (p *platform) TargetDisplayBounds() (sdl.Rect, error) {
+func (p *Platform_State) TargetDisplayBounds() (sdl.Rect, error) {
 	if p.TargetDisplay != -1 {
 		return sdl.GetDisplayBounds(p.TargetDisplay)
 	}
@@ -244,7 +297,9 @@ func (p *platform) TargetDisplayBounds() (sdl.Rect, error) {
 	return sdl.Rect{}, errors.New("Invalid -display constant: " + strconv.Itoa(p.TargetDisplay))
 }
 
-func (p *platform) ReshapeWindow(radius float32, force bool) {
+func (p *Platform_State) ReshapeWindow(radius float32, force bool) {
+	if p.Headless { return }
+
 	window_resized := false
 	radius_changed := radius != p.cornerRadius
 	p.cornerRadius = radius
@@ -296,12 +351,12 @@ func (p *platform) ReshapeWindow(radius float32, force bool) {
 	r = sdl.Rect{0, ir, w, h-ir*2}
 	shape.FillRect(&r, 255)
 
-	x, y := Platform.Window.GetPosition()
-	Platform.Window.SetShape(shape, sdl.ShapeModeDefault{})
-	Platform.Window.SetPosition(x, y)
+	x, y := p.Window.GetPosition()
+	p.Window.SetShape(shape, sdl.ShapeModeDefault{})
+	p.Window.SetPosition(x, y)
 }
 
-func (p *platform) ResizeWindow(width int32, height int32) {
+func (p *Platform_State) ResizeWindow(width int32, height int32) {
 	ow, oh := p.Window.GetSize()
 	ox, oy := p.Window.GetPosition()
 
@@ -339,25 +394,46 @@ func (p *platform) ResizeWindow(width int32, height int32) {
 	p.Window.SetPosition(x, y)
 }
 
-func (p *platform) WindowWidth() float32 {
+func (p *Platform_State) WindowWidth() float32 {
 	w, _ := p.Window.GetSize()
 	return float32(w)
 }
 
-func (p *platform) WindowHeight() float32 {
+func (p *Platform_State) WindowHeight() float32 {
 	_, h := p.Window.GetSize()
 	return float32(h)
 }
 
-func (p *platform) TextWidth(text string) float32 {
+func (p *Platform_State) TextWidth(text string) float32 {
 	return p.TextMetrics(text).X
 }
 
-func (p *platform) TextHeight(text string) float32 {
+func (p *Platform_State) TextHeight(text string) float32 {
 	return p.TextMetrics(text).Y
 }
 
-func (p *platform) EndFrame() {
+// Returns the ID of the window that the event is meant for, or
+// false if the event is not tied to a window.
+func EventWindowID(event sdl.Event) (uint32, bool) {
+	switch e := event.(type) {
+	case *sdl.WindowEvent: return e.WindowID, true
+	case *sdl.KeyboardEvent: return e.WindowID, true
+	case *sdl.TextEditingEvent: return e.WindowID, true
+	case *sdl.TextInputEvent: return e.WindowID, true
+	case *sdl.MouseMotionEvent: return e.WindowID, true
+	case *sdl.MouseButtonEvent: return e.WindowID, true
+	case *sdl.MouseWheelEvent: return e.WindowID, true
+	}
+	return 0, false
+}
+
+func (p *Platform_State) WindowID() uint32 {
+	id, err := p.Window.GetID()
+	Die(err)
+	return id
+}
+
+func (p *Platform_State) EndFrame() {
 	globals.FrameCacheClear()
 	p.Renderer.Present()
 }
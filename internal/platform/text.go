@@ -0,0 +1,150 @@
+package platform
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+	"github.com/glupi-borna/soko/internal/lru"
+	. "github.com/glupi-borna/soko/internal/utils"
+)
+
+const ELLIPSIS = "…"
+
+// Returns the size of the text when drawn with the given font.
+func (p *Platform_State) MeasureText(f *Font, text string) V2 {
+	key := textMetricsCacheKey(f, text)
+	m, ok := textMetricsCache[key]
+	if !ok {
+		w, h, _ := f.SDLFont.SizeUTF8(text)
+		m = V2{float32(w), float32(h)}
+		textMetricsCache[key] = m
+	}
+	return m
+}
+
+// Returns the distance between the tops of two consecutive lines.
+func (p *Platform_State) LineHeight(f *Font) float32 {
+	return float32(f.SDLFont.LineSkip())
+}
+
+// Returns the width of the text without caching it, used while
+// wrapping, so that partial lines do not fill the metrics cache.
+func measureWidth(f *Font, text string) float32 {
+	w, _, _ := f.SDLFont.SizeUTF8(text)
+	return float32(w)
+}
+
+// Returns the width of the text without caching it, for
+// text that changes often (e.g. while it is being typed).
+func (p *Platform_State) MeasureWidth(f *Font, text string) float32 {
+	return measureWidth(f, text)
+}
+
+var wrapCache = lru.New(500, func([]string) {})
+
+func wrapCacheKey(f *Font, text string, max_width float32, max_lines int) string {
+	return f.CacheName + "|" + FloatStr(max_width) + "|" + strconv.Itoa(max_lines) + "|" + text
+}
+
+// Splits the text into lines at newlines, and wraps lines that are wider
+// than max_width at spaces (or between letters, for words that do not fit
+// on a line by themselves). A max_width of 0 disables wrapping. If there
+// are more than max_lines lines, the last visible line ends with "…".
+func (p *Platform_State) WrapText(f *Font, text string, max_width float32, max_lines int) []string {
+	key := wrapCacheKey(f, text, max_width, max_lines)
+	lines, ok := wrapCache.Get(key)
+	if ok { return lines }
+
+	lines = make([]string, 0, 1)
+	for _, line := range p.WrapTextOffsets(f, text, max_width) {
+		lines = append(lines, text[line.Start:line.End])
+	}
+
+	if max_lines > 0 && len(lines) > max_lines {
+		lines = lines[:max_lines]
+		lines[max_lines-1] = ellipsize(f, lines[max_lines-1], max_width)
+	}
+
+	wrapCache.Set(key, lines)
+	return lines
+}
+
+// Appends an ellipsis to the line, removing letters
+// from its end until it fits into max_width.
+func ellipsize(f *Font, line string, max_width float32) string {
+	runes := []rune(strings.TrimRight(line, " "))
+	for len(runes) > 0 && max_width > 0 && measureWidth(f, string(runes)+ELLIPSIS) > max_width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + ELLIPSIS
+}
+
+// A line of wrapped text, as byte offsets into the text. The spaces
+// at which the text was wrapped are not part of any line.
+type TextLine struct{ Start, End int }
+
+// Paragraphs are cached separately, so that editing
+// one paragraph of a long text only wraps it again.
+var wrapOffsetsCache = lru.New(4096, func([]TextLine) {})
+
+// Wraps the text like WrapText (which is built on it), but returns
+// the offsets of the lines instead of the lines, for editing text.
+func (p *Platform_State) WrapTextOffsets(f *Font, text string, max_width float32) []TextLine {
+	lines := make([]TextLine, 0, 1)
+	start := 0
+
+	for {
+		end := strings.IndexByte(text[start:], '\n')
+		if end == -1 { end = len(text) } else { end += start }
+		paragraph := text[start:end]
+
+		key := wrapCacheKey(f, paragraph, max_width, 0)
+		wrapped, ok := wrapOffsetsCache.Get(key)
+		if !ok {
+			wrapped = wrapParagraphOffsets(f, paragraph, max_width)
+			wrapOffsetsCache.Set(key, wrapped)
+		}
+		for _, line := range wrapped {
+			lines = append(lines, TextLine{line.Start + start, line.End + start})
+		}
+
+		if end == len(text) { return lines }
+		start = end + 1
+	}
+}
+
+func wrapParagraphOffsets(f *Font, paragraph string, max_width float32) []TextLine {
+	if max_width <= 0 { return []TextLine{{0, len(paragraph)}} }
+
+	lines := make([]TextLine, 0, 1)
+	line := TextLine{}
+
+	for word_start := 0; word_start <= len(paragraph); {
+		word_end := strings.IndexByte(paragraph[word_start:], ' ')
+		if word_end == -1 { word_end = len(paragraph) } else { word_end += word_start }
+
+		if line.End == line.Start || measureWidth(f, paragraph[line.Start:word_end]) <= max_width {
+			line.End = word_end
+		} else {
+			lines = append(lines, line)
+			line = TextLine{word_start, word_end}
+		}
+
+		// Words that are too long are broken between letters
+		for measureWidth(f, paragraph[line.Start:line.End]) > max_width {
+			fit := line.Start
+			for _, r := range paragraph[line.Start:line.End] {
+				next := fit + utf8.RuneLen(r)
+				if fit > line.Start && measureWidth(f, paragraph[line.Start:next]) > max_width { break }
+				fit = next
+			}
+			if fit >= line.End { break }
+			lines = append(lines, TextLine{line.Start, fit})
+			line.Start = fit
+		}
+
+		word_start = word_end + 1
+	}
+
+	return append(lines, line)
+}
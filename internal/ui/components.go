@@ -6,6 +6,8 @@ import (
 	. "github.com/glupi-borna/soko/internal/utils"
 	"github.com/veandco/go-sdl2/sdl"
 	"golang.org/x/exp/constraints"
+	"math"
+	"time"
 )
 
 func drawNodeRectBg(pos V2, size V2, s *Style, hovered bool) {
@@ -69,26 +71,49 @@ func defaultRenderFn(n *Node) {
 }
 
 func textRenderFn(n *Node) {
-	t := n.Text
+	drawTextNode(n, CurrentUI.Active == n.UID || n.IsChildOfUID(CurrentUI.Active))
+}
+
+// Draws the background and the lines of a text node,
+// in the Active style variant if hov is true.
+func drawTextNode(n *Node, hov bool) {
 	s := n.GetStyle()
 	f := n.GetFont()
 
-	var c sdl.Color
-	var hov = false
-	if CurrentUI.Active == n.UID || n.IsChildOfUID(CurrentUI.Active) {
-		hov = true
-		c = s.Foreground.Active
-	} else {
-		c = s.Foreground.Normal
-	}
+	c := s.Foreground.Normal
+	if hov { c = s.Foreground.Active }
 
 	drawNodeRectBg(n.Pos, n.RealSize, s, hov)
 	Platform.SetColor(c)
 	Platform.RawSetFont(f)
-	Platform.DrawText(t, n.Pos.X, n.Pos.Y)
+
+	if n.lines == nil { n.layoutText() }
+	width := n.RealSize.X - n.Padding.xPadding()
+	x := n.Pos.X + n.Padding.Left
+	y := n.Pos.Y + n.Padding.Top
+	line_height := Platform.LineHeight(f)
+
+	for _, line := range n.lines {
+		var offset float32 = 0
+		switch n.TextAlign {
+		case A_CENTER:
+			offset = (width - Platform.MeasureText(f, line).X) * .5
+		case A_END:
+			offset = width - Platform.MeasureText(f, line).X
+		}
+		// Empty lines can not be rendered to a texture
+		if line != "" { Platform.DrawText(line, x+offset, y) }
+		y += line_height
+	}
 }
 
-type SliderState struct{ Perc float32 }
+type SliderState struct {
+	Perc float32
+	// Size of a step, as a fraction of the range (0 for no snapping)
+	Step float32
+	// Set when the keyboard or the wheel moved the slider
+	moved bool
+}
 
 func hSliderRenderFn(n *Node) {
 	state := NodeState[SliderState](n)
@@ -131,66 +156,90 @@ type Number interface {
 	constraints.Integer | constraints.Float
 }
 
-func hSliderUpdateFn(n *Node) {
-	state := NodeState[SliderState](n)
+// Number of steps that sliders without a step size have.
+const SLIDER_STEPS = 50
 
-	if CurrentUI.Mode == IM_MOUSE {
-		if n.UID == n.UI.Hot {
-			state.Perc = Clamp((Platform.MousePos.X-n.Pos.X)/n.RealSize.X, 0, 1)
-		}
+// Number of steps that PageUp/PageDown move a slider by.
+const SLIDER_PAGE_STEPS = 10
 
-		if n.HasMouse() {
-			CurrentUI.SetActive(n, false)
-			if Platform.MousePressed(sdl.BUTTON_LEFT) {
-				CurrentUI.SetHot(n, false)
-			}
-			if Platform.MouseReleased(sdl.BUTTON_LEFT) {
-				CurrentUI.SetHot(nil, false)
-			}
-		}
-	}
+// Returns the percentage closest to perc that lies on a step.
+func (s *SliderState) snap(perc float32) float32 {
+	if s.Step <= 0 { return Clamp(perc, 0, 1) }
+	return Clamp(float32(math.Round(float64(perc/s.Step)))*s.Step, 0, 1)
+}
 
-	if CurrentUI.Mode == IM_KBD && CurrentUI.Active == n.UID {
-		// xkbd := Btof(KeyboardPressed(sdl.SCANCODE_RIGHT)) - Btof(KeyboardPressed(sdl.SCANCODE_LEFT))
-		// ykbd := Btof(KeyboardPressed(sdl.SCANCODE_DOWN)) - Btof(KeyboardPressed(sdl.SCANCODE_UP))
-		/*
-			if xkbd != 0 && ykbd != 0 {
-				_UI.MoveActive(n, xkbd, ykbd)
-			}
-		*/
-	}
+// Moves the slider by the given number of steps.
+func (s *SliderState) move(steps float32) {
+	step := s.Step
+	if step <= 0 { step = 1. / SLIDER_STEPS }
+	s.Perc = s.snap(s.Perc + steps*step)
+	s.moved = true
 }
 
-func vSliderUpdateFn(n *Node) {
+// Handles the input that is shared by both slider directions. The inc and
+// dec keys step the slider when it is focused, and the wheel steps it when
+// it is hovered. pos_perc returns the percentage under the mouse.
+func sliderUpdate(n *Node, inc, dec string, pos_perc func() float32) {
 	state := NodeState[SliderState](n)
 
+	if n.UID == n.UI.Hot {
+		if CurrentUI.Mode == IM_MOUSE { state.Perc = state.snap(pos_perc()) }
+		// The mouse is captured, so the release may happen outside of the window
+		if Platform.MouseReleased(sdl.BUTTON_LEFT) {
+			CurrentUI.SetHot(nil, false)
+			sdl.CaptureMouse(false)
+		}
+	}
+
 	if CurrentUI.Mode == IM_MOUSE {
-		if n.UID == n.UI.Hot {
-			state.Perc = 1 - Clamp((Platform.MousePos.Y-n.Pos.Y)/n.RealSize.Y, 0, 1)
+		if n.UID == n.UI.ScrollTarget && Platform.WheelDelta.Y != 0 {
+			state.move(Platform.WheelDelta.Y)
 		}
 
 		if n.HasMouse() {
 			CurrentUI.SetActive(n, false)
+			CurrentUI.SetScrollTarget(n, false)
 			if Platform.MousePressed(sdl.BUTTON_LEFT) {
 				CurrentUI.SetHot(n, false)
-			}
-			if Platform.MouseReleased(sdl.BUTTON_LEFT) {
-				CurrentUI.SetHot(nil, false)
+				CurrentUI.SetFocus(n)
+				sdl.CaptureMouse(true)
 			}
 		}
 	}
 
-	if CurrentUI.Mode == IM_KBD && CurrentUI.Active == n.UID {
-		// xkbd := Btof(KeyboardPressed(sdl.SCANCODE_RIGHT)) - Btof(KeyboardPressed(sdl.SCANCODE_LEFT))
-		// ykbd := Btof(KeyboardPressed(sdl.SCANCODE_DOWN)) - Btof(KeyboardPressed(sdl.SCANCODE_UP))
-		/*
-			if xkbd != 0 && ykbd != 0 {
-				_UI.MoveActive(n, xkbd, ykbd)
-			}
-		*/
+	if n.HasFocus() {
+		switch {
+		case Platform.ComboPressed(inc):
+			state.move(1)
+		case Platform.ComboPressed(dec):
+			state.move(-1)
+		case Platform.ComboPressed("PageUp"):
+			state.move(SLIDER_PAGE_STEPS)
+		case Platform.ComboPressed("PageDown"):
+			state.move(-SLIDER_PAGE_STEPS)
+		case Platform.ComboPressed("Home"):
+			state.Perc, state.moved = 0, true
+		case Platform.ComboPressed("End"):
+			state.Perc, state.moved = 1, true
+		default:
+			return
+		}
+		CurrentUI.ConsumeNav()
 	}
 }
 
+func hSliderUpdateFn(n *Node) {
+	sliderUpdate(n, "Right", "Left", func() float32 {
+		return (Platform.MousePos.X - n.Pos.X) / n.RealSize.X
+	})
+}
+
+func vSliderUpdateFn(n *Node) {
+	sliderUpdate(n, "Up", "Down", func() float32 {
+		return 1 - (Platform.MousePos.Y-n.Pos.Y)/n.RealSize.Y
+	})
+}
+
 func WithNode(n *Node, fn func(*Node)) *Node {
 	fn(n)
 	CurrentUI.Pop(n)
@@ -209,6 +258,44 @@ func Column() *Node {
 	return n
 }
 
+// Lays out children horizontally, continuing on a new
+// line when there is no more space.
+func Wrap() *Node {
+	n := CurrentUI.Push("wrap")
+	n.Layout = LT_WRAP
+	return n
+}
+
+// Lays out children in cells of the given column and row tracks.
+// Children are placed by their Cell, or fill the grid row by row.
+func Grid(columns, rows []Dimension) *Node {
+	n := CurrentUI.Push("grid")
+	n.Layout = LT_GRID
+	n.Columns = columns
+	n.Rows = rows
+	return n
+}
+
+// Lays out children on top of each other. Children are positioned
+// by their JustifySelf and AlignSelf, and drawn in ZIndex order.
+func Stack() *Node {
+	n := CurrentUI.Push("stack")
+	n.Layout = LT_STACK
+	return n
+}
+
+// Container that is taken out of the layout flow and drawn above
+// everything else. relative_to is "" for the parent, "root",
+// or the UID of the node to position against. Floats that would
+// start above or left of the window are moved into it.
+func Float(relative_to string) *Node {
+	n := CurrentUI.Push("float")
+	n.Layout = LT_VERTICAL
+	n.Position = P_ABSOLUTE
+	n.RelativeTo = relative_to
+	return n
+}
+
 func Invisible(dim Dimension) *Node {
 	n := CurrentUI.Push("invisible")
 	defer CurrentUI.Pop(n)
@@ -329,52 +416,54 @@ func Button() (*Node, bool) {
 	return n, n.Clicked()
 }
 
-func Slider(val, min, max float32) (float32, *Node) {
+// Returns the value of the slider, and whether the user changed it this
+// frame. If step is given, the value snaps to multiples of step (from min).
+func Slider(val, min, max float32, step ...float32) (float32, *Node, bool) {
 	n := CurrentUI.Push("hslider")
 	defer CurrentUI.Pop(n)
 
-	state := NodeState[SliderState](n)
-	diff := max - min
-
 	n.Flags.Focusable = true
 	n.RenderFn = hSliderRenderFn
 	n.UpdateFn = hSliderUpdateFn
 	n.Style = SliderStyle
 	n.Size.W = Px(200)
 
-	var perc float32
-	if n.UID == CurrentUI.Hot {
-		perc = state.Perc
-	} else {
-		perc = Clamp(val-min, 0, diff) / diff
-		state.Perc = perc
-	}
-
-	return (perc * diff) + min, n
+	new_val, changed := sliderValue(n, val, min, max, step)
+	return new_val, n, changed
 }
 
-func VSlider(val, min, max float32) (float32, *Node) {
+// Vertical Slider.
+func VSlider(val, min, max float32, step ...float32) (float32, *Node, bool) {
 	n := CurrentUI.Push("vslider")
 	defer CurrentUI.Pop(n)
 
-	state := NodeState[SliderState](n)
-	diff := max - min
-
 	n.Flags.Focusable = true
 	n.RenderFn = vSliderRenderFn
 	n.UpdateFn = vSliderUpdateFn
 	n.Style = SliderStyle
 	n.Size.H = Px(200)
 
-	var perc float32
-	if n.UID == CurrentUI.Hot {
-		perc = state.Perc
-	} else {
-		perc = Clamp(val-min, 0, diff) / diff
-		state.Perc = perc
+	new_val, changed := sliderValue(n, val, min, max, step)
+	return new_val, n, changed
+}
+
+// Takes the value from the slider state if the user is interacting
+// with the slider, and updates the state from val otherwise.
+func sliderValue(n *Node, val, min, max float32, step []float32) (float32, bool) {
+	state := NodeState[SliderState](n)
+	diff := max - min
+
+	state.Step = 0
+	if len(step) > 0 && diff != 0 { state.Step = step[0] / diff }
+
+	if n.UID != CurrentUI.Hot && !state.moved {
+		state.Perc = Clamp(val-min, 0, diff) / diff
+		return (state.Perc * diff) + min, false
 	}
 
-	return (perc * diff) + min, n
+	state.moved = false
+	if state.Perc == Clamp(val-min, 0, diff)/diff { return val, false }
+	return (state.Perc * diff) + min, true
 }
 
 func imgRenderFn(n *Node) {
@@ -400,27 +489,168 @@ type Scroller struct {
 	Window, View *Node
 }
 
+// What the mouse is dragging in a scroll window
+type SCROLL_DRAG int
+
+const (
+	SD_NONE    SCROLL_DRAG = iota
+	SD_PRESSED // Pressed on the content, but not moved far enough to pan it
+	SD_CONTENT
+	SD_VBAR
+	SD_HBAR
+)
+
+const SCROLLBAR_WIDTH = 6
+
+// Distance that the wheel and the arrow keys scroll by
+const SCROLL_WHEEL_STEP = 10
+const SCROLL_KEY_STEP = 40
+
+// Distance that the mouse has to move after a press
+// on the content before the content is panned
+const SCROLL_PAN_THRESHOLD = 4
+
+// Time for which the scrollbars stay visible after scrolling
+const SCROLLBAR_LINGER = time.Second
+
 type ScrollerState struct {
 	TargetOffset V2
 	Offset V2
 	MaxOffset V2
+	// Size of the visible part of the content
+	ViewSize V2
 	ParentClip sdl.Rect
+
+	// Draw scrollbars, which show up while scrolling and can be dragged
+	Scrollbars bool
+	// Pan the content by dragging it (for touchpads)
+	DragPan bool
+	// Follow the bottom of the content as it grows,
+	// as long as the view is scrolled to the bottom
+	StickToBottom bool
+	// Take the focus with Tab and clicks, to scroll with the keyboard
+	// while none of the children is focused (e.g. in log views)
+	Focusable bool
+
+	Drag       SCROLL_DRAG
+	dragStart  V2 // Mouse position at the start of the drag
+	dragOffset V2 // TargetOffset at the start of the drag
+	lastScroll time.Duration
+	// UID of the node to scroll into view (see Scroller.ScrollTo)
+	scrollTo string
+	// Focused node in the previous frame
+	focus string
+}
+
+// Returns how far the content extends past each
+// edge of the window, e.g. for drawing fade edges.
+func (s *ScrollerState) Overflow() (top, right, bottom, left float32) {
+	return -s.Offset.Y, s.MaxOffset.X + s.Offset.X, s.MaxOffset.Y + s.Offset.Y, -s.Offset.X
+}
+
+// Returns true if the view is scrolled to the bottom.
+func (s *ScrollerState) AtBottom() bool {
+	return s.TargetOffset.Y <= -s.MaxOffset.Y
+}
+
+// Returns the position and size of the scrollbar thumb, and the
+// length of its track. Returns false if the content fits on that axis.
+func (s *ScrollerState) thumb(n *Node, vertical bool) (pos, size V2, track float32, ok bool) {
+	if vertical {
+		if s.MaxOffset.Y <= 0 { return pos, size, track, false }
+		track = n.RealSize.Y - 4
+		size.X = SCROLLBAR_WIDTH
+		size.Y = Max(track*s.ViewSize.Y/(s.ViewSize.Y+s.MaxOffset.Y), SCROLLBAR_WIDTH*3)
+		pos.X = n.Pos.X + n.RealSize.X - SCROLLBAR_WIDTH - 2
+		pos.Y = n.Pos.Y + 2 + (track-size.Y)*(-s.Offset.Y/s.MaxOffset.Y)
+	} else {
+		if s.MaxOffset.X <= 0 { return pos, size, track, false }
+		track = n.RealSize.X - 4
+		size.X = Max(track*s.ViewSize.X/(s.ViewSize.X+s.MaxOffset.X), SCROLLBAR_WIDTH*3)
+		size.Y = SCROLLBAR_WIDTH
+		pos.X = n.Pos.X + 2 + (track-size.X)*(-s.Offset.X/s.MaxOffset.X)
+		pos.Y = n.Pos.Y + n.RealSize.Y - SCROLLBAR_WIDTH - 2
+	}
+	return pos, size, track, true
+}
+
+// Returns true if the point is on the strip along
+// the edge of the window that the scrollbar moves in.
+func (s *ScrollerState) onScrollbar(n *Node, vertical bool, p V2) bool {
+	if !s.Scrollbars || !n.contains(p.X, p.Y) { return false }
+	_, _, _, ok := s.thumb(n, vertical)
+	if !ok { return false }
+	if vertical { return p.X >= n.Pos.X+n.RealSize.X-SCROLLBAR_WIDTH-4 }
+	return p.Y >= n.Pos.Y+n.RealSize.Y-SCROLLBAR_WIDTH-4
+}
+
+// Scrolls the window by the smallest amount that makes the target visible.
+func (s *ScrollerState) scrollIntoView(view, target *Node) {
+	// Position of the target in the content
+	x := target.Pos.X - view.Pos.X
+	y := target.Pos.Y - view.Pos.Y
+	s.revealRect(x, y, target.RealSize.X, target.RealSize.Y)
+}
+
+// Scrolls by the smallest amount that makes the
+// rectangle (in content coordinates) visible.
+func (s *ScrollerState) revealRect(x, y, w, h float32) {
+	if y < -s.TargetOffset.Y {
+		s.TargetOffset.Y = -y
+	} else if y+h > s.ViewSize.Y-s.TargetOffset.Y {
+		s.TargetOffset.Y = s.ViewSize.Y - y - h
+	}
+
+	if x < -s.TargetOffset.X {
+		s.TargetOffset.X = -x
+	} else if x+w > s.ViewSize.X-s.TargetOffset.X {
+		s.TargetOffset.X = s.ViewSize.X - x - w
+	}
+}
+
+// Clamps the target offset, and animates the offset towards it.
+// last_target is the target offset at the start of the frame.
+func (s *ScrollerState) settle(n *Node, last_target V2) {
+	s.TargetOffset.X = Clamp(s.TargetOffset.X, -s.MaxOffset.X, 0)
+	s.TargetOffset.Y = Clamp(s.TargetOffset.Y, -s.MaxOffset.Y, 0)
+	if s.TargetOffset != last_target { s.lastScroll = CurrentUI.FrameStart }
+
+	s.Offset.X = AnimateSPD(s.TargetOffset.X, 2048, n.UID+"__scrolloffsetx")
+	s.Offset.Y = AnimateSPD(s.TargetOffset.Y, 2048, n.UID+"__scrolloffsety")
 }
 
 func scrollWindowRenderFn(n *Node) {
 	state := NodeState[ScrollerState](n)
 	state.ParentClip = Platform.Renderer.GetClipRect()
-	rect := n.sdlRect()
-	rect.X += int32(n.Padding.Left)
-	rect.Y += int32(n.Padding.Top)
-	rect.W -= int32(n.Padding.xPadding())
-	rect.H -= int32(n.Padding.yPadding())
+	rect := n.contentRect()
 	Platform.Renderer.SetClipRect(&rect)
 }
 
 func scrollWindowPostRenderFn(n *Node) {
 	state := NodeState[ScrollerState](n)
 	Platform.Renderer.SetClipRect(&state.ParentClip)
+	drawScrollbars(n, state)
+}
+
+// Draws the scrollbars, if they are enabled and visible.
+func drawScrollbars(n *Node, state *ScrollerState) {
+	if !state.Scrollbars { return }
+
+	mouse := Platform.MousePos
+	visible := state.Drag == SD_VBAR || state.Drag == SD_HBAR ||
+		CurrentUI.FrameStart-state.lastScroll < SCROLLBAR_LINGER ||
+		(n.HasMouse() && (state.onScrollbar(n, true, mouse) || state.onScrollbar(n, false, mouse)))
+	alpha := Animate(Btof(visible), n.UID+"-scrollbar")
+	if alpha < 0.01 { return }
+
+	c := n.GetStyle().Foreground.Normal
+	c.A = uint8(float32(c.A) * alpha * .6)
+	Platform.SetColor(c)
+
+	for _, vertical := range []bool{true, false} {
+		pos, size, _, ok := state.thumb(n, vertical)
+		if ok { Platform.DrawRoundRectFilled(pos.X, pos.Y, size.X, size.Y, SCROLLBAR_WIDTH/2) }
+	}
 }
 
 func scrollWindowPreLayout(n *Node) {
@@ -438,28 +668,154 @@ func scrollWindowUpdateFn(n *Node) {
 	n.UpdateChildren()
 
 	state := NodeState[ScrollerState](n)
+	view := n.Children[0]
+	at_bottom := state.AtBottom()
+	last_target := state.TargetOffset
+
+	state.ViewSize.X = n.RealSize.X - n.Padding.xPadding()
+	state.ViewSize.Y = n.RealSize.Y - n.Padding.yPadding()
+	state.MaxOffset.X = max(view.RealSize.X - state.ViewSize.X, 0)
+	state.MaxOffset.Y = max(view.RealSize.Y - state.ViewSize.Y, 0)
+
+	if state.StickToBottom && at_bottom {
+		state.TargetOffset.Y = -state.MaxOffset.Y
+		last_target.Y = state.TargetOffset.Y
+	}
 
-	state.MaxOffset.X = max(n.Children[0].RealSize.X - n.RealSize.X + n.Padding.xPadding(), 0)
-	state.MaxOffset.Y = max(n.Children[0].RealSize.Y - n.RealSize.Y + n.Padding.yPadding(), 0)
-	state.Offset.X = AnimateSPD(state.TargetOffset.X, 2048, n.UID+"__scrolloffsetx")
-	state.Offset.Y = AnimateSPD(state.TargetOffset.Y, 2048, n.UID+"__scrolloffsety")
+	if state.scrollTo != "" {
+		target := view.Find(func(c *Node) bool { return c.UID == state.scrollTo })
+		if target != nil { state.scrollIntoView(view, target) }
+		state.scrollTo = ""
+	}
 
-	if CurrentUI.Mode == IM_MOUSE {
-		if n.UID == n.UI.ScrollTarget {
-			state.TargetOffset.X = Clamp(state.TargetOffset.X + Platform.WheelDelta.X * 10, -state.MaxOffset.X, 0)
-			state.TargetOffset.Y = Clamp(state.TargetOffset.Y + Platform.WheelDelta.Y * 10, -state.MaxOffset.Y, 0)
+	// Keyboard navigation moves focus to nodes outside of the view
+	if state.focus != CurrentUI.Focus {
+		state.focus = CurrentUI.Focus
+		target := view.Find(func(c *Node) bool { return c.UID == state.focus })
+		if target != nil { state.scrollIntoView(view, target) }
+	}
+
+	scrollWindowMouse(n, state)
+	scrollWindowKeyboard(n, state)
+	state.settle(n, last_target)
+}
+
+func scrollWindowMouse(n *Node, state *ScrollerState) {
+	mouse := Platform.MousePos
+	delta := V2{X: mouse.X - state.dragStart.X, Y: mouse.Y - state.dragStart.Y}
+
+	switch state.Drag {
+	case SD_PRESSED:
+		if delta.ManhattanLength() > SCROLL_PAN_THRESHOLD {
+			// Panning cancels the click on the node under the mouse
+			state.Drag = SD_CONTENT
+			CurrentUI.SetHot(n, true)
+			sdl.CaptureMouse(true)
+		}
+	case SD_CONTENT:
+		state.TargetOffset = V2{X: state.dragOffset.X + delta.X, Y: state.dragOffset.Y + delta.Y}
+	case SD_VBAR, SD_HBAR:
+		vertical := state.Drag == SD_VBAR
+		_, size, track, ok := state.thumb(n, vertical)
+		if !ok { break }
+		if vertical {
+			state.TargetOffset.Y = state.dragOffset.Y - delta.Y*state.MaxOffset.Y/(track-size.Y)
+		} else {
+			state.TargetOffset.X = state.dragOffset.X - delta.X*state.MaxOffset.X/(track-size.X)
 		}
+	}
 
-		if n.HasMouse() {
-			CurrentUI.SetScrollTarget(n, false)
+	if state.Drag != SD_NONE && Platform.MouseReleased(sdl.BUTTON_LEFT) {
+		if state.Drag != SD_PRESSED { sdl.CaptureMouse(false) }
+		if n.UI.Hot == n.UID { CurrentUI.SetHot(nil, true) }
+		state.Drag = SD_NONE
+	}
+
+	if CurrentUI.Mode != IM_MOUSE { return }
+
+	if n.UID == n.UI.ScrollTarget {
+		state.TargetOffset.X += Platform.WheelDelta.X * SCROLL_WHEEL_STEP
+		state.TargetOffset.Y += Platform.WheelDelta.Y * SCROLL_WHEEL_STEP
+	}
+
+	if !n.HasMouse() { return }
+	CurrentUI.SetScrollTarget(n, false)
+	if !Platform.MousePressed(sdl.BUTTON_LEFT) { return }
+
+	if !CurrentUI.HotChanged && n.Flags.Focusable { CurrentUI.SetFocus(n) }
+	state.dragStart = mouse
+
+	for _, vertical := range []bool{true, false} {
+		if !state.onScrollbar(n, vertical, mouse) { continue }
+
+		// Pressing next to the thumb moves its center to the mouse
+		pos, size, track, _ := state.thumb(n, vertical)
+		if vertical && (mouse.Y < pos.Y || mouse.Y > pos.Y+size.Y) {
+			perc := (mouse.Y - n.Pos.Y - 2 - size.Y*.5) / (track - size.Y)
+			state.TargetOffset.Y = -Clamp(perc, 0, 1) * state.MaxOffset.Y
 		}
+		if !vertical && (mouse.X < pos.X || mouse.X > pos.X+size.X) {
+			perc := (mouse.X - n.Pos.X - 2 - size.X*.5) / (track - size.X)
+			state.TargetOffset.X = -Clamp(perc, 0, 1) * state.MaxOffset.X
+		}
+
+		state.Drag = SD_HBAR
+		if vertical { state.Drag = SD_VBAR }
+		state.dragOffset = state.TargetOffset
+		CurrentUI.SetHot(n, true)
+		sdl.CaptureMouse(true)
+		return
 	}
 
-	if CurrentUI.Mode == IM_KBD && CurrentUI.Active == n.UID {
-		// @TODO: Keyboard interaction
+	if state.DragPan {
+		state.Drag = SD_PRESSED
+		state.dragOffset = state.TargetOffset
 	}
 }
 
+func scrollWindowKeyboard(n *Node, state *ScrollerState) {
+	if !n.HasFocus() { return }
+
+	var d V2
+	switch {
+	case Platform.ComboPressed("Up"): d.Y = SCROLL_KEY_STEP
+	case Platform.ComboPressed("Down"): d.Y = -SCROLL_KEY_STEP
+	case Platform.ComboPressed("Left"): d.X = SCROLL_KEY_STEP
+	case Platform.ComboPressed("Right"): d.X = -SCROLL_KEY_STEP
+	case Platform.ComboPressed("PageUp"): d.Y = state.ViewSize.Y
+	case Platform.ComboPressed("PageDown"): d.Y = -state.ViewSize.Y
+	case Platform.ComboPressed("Home"): d.Y = state.MaxOffset.Y
+	case Platform.ComboPressed("End"): d.Y = -state.MaxOffset.Y
+	default:
+		return
+	}
+
+	target := V2{X: state.TargetOffset.X + d.X, Y: state.TargetOffset.Y + d.Y}
+	target.X = Clamp(target.X, -state.MaxOffset.X, 0)
+	target.Y = Clamp(target.Y, -state.MaxOffset.Y, 0)
+	// At the edge, the arrow keys move focus out of the window instead
+	if target == state.TargetOffset { return }
+	state.TargetOffset = target
+	CurrentUI.ConsumeNav()
+}
+
+// Returns the state of the scroll window, which can be
+// used to configure it, or to read its scroll offset.
+func (s Scroller) State() *ScrollerState {
+	return NodeState[ScrollerState](s.Window)
+}
+
+// Scrolls the window so that the node (which
+// has to be inside of the window) is visible.
+func (s Scroller) ScrollTo(node *Node) {
+	s.State().scrollTo = node.UID
+}
+
+// Scrolls the window to the given offset from the top left of the content.
+func (s Scroller) ScrollToOffset(x, y float32) {
+	s.State().TargetOffset = V2{X: -x, Y: -y}
+}
+
 func ScrollBegin() Scroller {
 	var s Scroller
 	s.Window = CurrentUI.Push("scroll_window")
@@ -471,6 +827,7 @@ func ScrollBegin() Scroller {
 	s.Window.PostRenderFn = scrollWindowPostRenderFn
 	s.Window.UpdateFn = scrollWindowUpdateFn
 	s.Window.PreLayout = scrollWindowPreLayout
+	s.Window.Flags.Clip = true
 
 	s.View.Size.W = ChildrenSize()
 	s.View.Size.H = ChildrenSize()
@@ -481,5 +838,7 @@ func ScrollBegin() Scroller {
 func ScrollEnd() {
 	Assert(CurrentUI.Current.Type == "scroll_view", "Scroll")
 	Assert(CurrentUI.Current.Parent.Type == "scroll_window", "Scroll")
-	CurrentUI.Pop(CurrentUI.Current.Parent)
+	window := CurrentUI.Current.Parent
+	window.Flags.Focusable = NodeState[ScrollerState](window).Focusable
+	CurrentUI.Pop(window)
 }
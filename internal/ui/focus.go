@@ -0,0 +1,159 @@
+package ui
+
+import (
+	. "github.com/glupi-borna/soko/internal/platform"
+	. "github.com/glupi-borna/soko/internal/utils"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// Appends the focusable nodes in the subtree of n to out, in tree order.
+func (n *Node) focusables(out []*Node) []*Node {
+	if n.Flags.Focusable { out = append(out, n) }
+	for _, child := range n.Children {
+		out = child.focusables(out)
+	}
+	return out
+}
+
+// Returns true if the node has keyboard focus.
+func (n *Node) HasFocus() bool {
+	return n.UID != "" && n.UID == CurrentUI.Focus
+}
+
+// Returns true in the frame in which the focused node
+// was activated with Enter or Space.
+func (n *Node) Activated() bool {
+	if !n.Flags.Focusable || !n.HasFocus() { return false }
+	return Platform.ComboPressed("Return") ||
+		Platform.ComboPressed("Keypad Enter") ||
+		Platform.ComboPressed("Space")
+}
+
+// Gives keyboard focus to the node (or removes it, if the node is nil).
+func (ui *UI_State) SetFocus(node *Node) {
+	if node == nil {
+		ui.Focus = ""
+	} else {
+		ui.Focus = node.UID
+	}
+}
+
+// Gives keyboard focus to the node.
+func Focus(node *Node) { CurrentUI.SetFocus(node) }
+
+// Gives keyboard focus to the node, unless another node is focused.
+func AutoFocus(node *Node) {
+	if CurrentUI.Focus == "" { CurrentUI.SetFocus(node) }
+}
+
+// Stops the arrow keys from moving focus in this frame. Called
+// by focused nodes that handle the arrow keys themselves.
+func (ui *UI_State) ConsumeNav() { ui.navConsumed = true }
+
+// Moves focus with Tab/Shift+Tab (in tree order) and the
+// arrow keys (to the nearest node in that direction).
+func (ui *UI_State) navigateFocus() {
+	nodes := ui.Root.focusables(nil)
+
+	current := -1
+	for i, n := range nodes {
+		if n.UID == ui.Focus { current = i }
+	}
+	if current == -1 { ui.Focus = "" }
+	if len(nodes) == 0 { return }
+
+	var dx, dy float32
+	switch {
+	case Platform.ComboPressed("Tab"):
+		ui.SetFocus(nodes[(current+1)%len(nodes)])
+		return
+	case Platform.ComboPressed("Shift+Tab"):
+		if current <= 0 { current = len(nodes) }
+		ui.SetFocus(nodes[current-1])
+		return
+	case ui.navConsumed:
+		return
+	case Platform.ComboPressed("Left"):
+		dx = -1
+	case Platform.ComboPressed("Right"):
+		dx = 1
+	case Platform.ComboPressed("Up"):
+		dy = -1
+	case Platform.ComboPressed("Down"):
+		dy = 1
+	default:
+		return
+	}
+
+	if current == -1 {
+		ui.SetFocus(nodes[0])
+		return
+	}
+	next := nearestInDirection(nodes[current], nodes, dx, dy)
+	if next != nil { ui.SetFocus(next) }
+}
+
+// Returns the node closest to from in the direction (dx, dy), where one of
+// dx and dy is 0. Nodes that overlap from on the cross axis are preferred.
+// Returns nil if there are no nodes in that direction.
+func nearestInDirection(from *Node, nodes []*Node, dx, dy float32) *Node {
+	fc := from.center()
+	var best *Node
+	var best_score float32
+
+	for _, n := range nodes {
+		if n == from { continue }
+		c := n.center()
+		along := (c.X-fc.X)*dx + (c.Y-fc.Y)*dy
+		if along <= 0 { continue }
+
+		var across float32
+		if dx != 0 {
+			across = rangeGap(from.Pos.Y, from.RealSize.Y, n.Pos.Y, n.RealSize.Y)
+		} else {
+			across = rangeGap(from.Pos.X, from.RealSize.X, n.Pos.X, n.RealSize.X)
+		}
+
+		score := along + across*2
+		if best == nil || score < best_score {
+			best, best_score = n, score
+		}
+	}
+
+	return best
+}
+
+func (n *Node) center() V2 {
+	return V2{X: n.Pos.X + n.RealSize.X*.5, Y: n.Pos.Y + n.RealSize.Y*.5}
+}
+
+// Returns the distance between two ranges, or 0 if they overlap.
+func rangeGap(start_a, len_a, start_b, len_b float32) float32 {
+	return Max(Max(start_b-(start_a+len_a), start_a-(start_b+len_b)), 0)
+}
+
+// Returns the focus ring color of the node, inherited from its
+// ancestors if the style does not set one.
+func (n *Node) focusRingColor() sdl.Color {
+	for p := n; p != nil; p = p.Parent {
+		if p.Style != nil && p.Style.FocusRing.A != 0 { return p.Style.FocusRing }
+	}
+	return DefaultStyle.FocusRing
+}
+
+// Draws the focus ring around the node, if it is focused
+// and the keyboard is being used.
+func drawFocusRing(n *Node) {
+	if CurrentUI.Mode != IM_KBD || !n.HasFocus() { return }
+
+	var radius float32 = 0
+	if n.Style != nil { radius = n.Style.CornerRadius.Active }
+
+	Platform.SetColor(n.focusRingColor())
+	for i := float32(1); i <= 2; i++ {
+		Platform.DrawRoundRectOutlined(
+			n.Pos.X-i, n.Pos.Y-i,
+			n.RealSize.X+i*2, n.RealSize.Y+i*2,
+			radius+i)
+	}
+}
@@ -0,0 +1,221 @@
+package ui
+
+import (
+	. "github.com/glupi-borna/soko/internal/utils"
+)
+
+// Assigns every child of a LT_GRID node to a cell, and returns the
+// number of columns and rows. Children without an explicit Cell fill
+// the first free cells (in row-major order) that fit their span.
+// Rows that are not defined in n.Rows are added as needed.
+func (n *Node) placeGridCells() (cols int, rows int) {
+	cols = Max(len(n.Columns), 1)
+	rows = len(n.Rows)
+	occupied := make(map[[2]int]bool)
+
+	place := func(child *Node, col, row int) {
+		c := &child.gridCell
+		c.Col = Min(col, cols-1)
+		c.Row = row
+		c.ColSpan = Clamp(child.Cell.ColSpan, 1, cols-c.Col)
+		c.RowSpan = Max(child.Cell.RowSpan, 1)
+		for x := c.Col; x < c.Col+c.ColSpan; x++ {
+			for y := c.Row; y < c.Row+c.RowSpan; y++ {
+				occupied[[2]int{x, y}] = true
+			}
+		}
+		rows = Max(rows, c.Row+c.RowSpan)
+	}
+
+	for _, child := range n.flowChildren() {
+		if child.Cell.Col > 0 && child.Cell.Row > 0 {
+			place(child, child.Cell.Col-1, child.Cell.Row-1)
+		}
+	}
+
+	fits := func(col, row, col_span, row_span int) bool {
+		if col+col_span > cols { return false }
+		for x := col; x < col+col_span; x++ {
+			for y := row; y < row+row_span; y++ {
+				if occupied[[2]int{x, y}] { return false }
+			}
+		}
+		return true
+	}
+
+	cursor := 0
+	for _, child := range n.flowChildren() {
+		if child.Cell.Col > 0 && child.Cell.Row > 0 { continue }
+		col_span := Clamp(child.Cell.ColSpan, 1, cols)
+		row_span := Max(child.Cell.RowSpan, 1)
+		for !fits(cursor%cols, cursor/cols, col_span, row_span) {
+			cursor++
+		}
+		place(child, cursor%cols, cursor/cols)
+		cursor += col_span
+	}
+
+	return cols, rows
+}
+
+// Returns the size of the largest child that sits in the track
+// and does not span other tracks. Fr sized children fill their
+// cell, so they do not contribute.
+func (n *Node) trackContentSize(track int, horizontal bool) (size float32) {
+	for _, child := range n.flowChildren() {
+		c := child.gridCell
+		if horizontal {
+			if c.Col != track || c.ColSpan != 1 || child.Size.W.Type == DT_FR { continue }
+			size = Max(size, nodeRealX(child))
+		} else {
+			if c.Row != track || c.RowSpan != 1 || child.Size.H.Type == DT_FR { continue }
+			size = Max(size, nodeRealY(child))
+		}
+	}
+	return size
+}
+
+// Grows the content sized tracks covered by children that span several
+// tracks, when such a child does not fit. The missing size is shared
+// evenly between the content sized tracks.
+func (n *Node) growSpannedTracks(sizes []float32, auto []bool, gap float32, horizontal bool) {
+	for _, child := range n.Children {
+		c := child.gridCell
+		track, span := c.Row, c.RowSpan
+		var size float32
+		if horizontal {
+			if child.Size.W.Type == DT_FR { continue }
+			track, span, size = c.Col, c.ColSpan, nodeRealX(child)
+		} else {
+			if child.Size.H.Type == DT_FR { continue }
+			size = nodeRealY(child)
+		}
+		if span < 2 { continue }
+
+		count := 0
+		for i := track; i < track+span && i < len(sizes); i++ {
+			if auto[i] { count++ }
+		}
+		missing := size - spanSize(sizes, track, span, gap)
+		if count == 0 || missing <= 0 { continue }
+
+		for i := track; i < track+span && i < len(sizes); i++ {
+			if auto[i] { sizes[i] += missing / float32(count) }
+		}
+	}
+}
+
+// Calculates track sizes. Fr tracks share the space that is left in
+// available, and are sized like ChildrenSize tracks if the available
+// space is not known yet.
+func (n *Node) gridTracks(tracks []Dimension, count int, available float32, fixed bool, gap float32, horizontal bool) []float32 {
+	sizes := make([]float32, count)
+	auto := make([]bool, count)
+	var used, fracs float32
+
+	for i := range sizes {
+		d := ChildrenSize()
+		if i < len(tracks) { d = tracks[i] }
+
+		switch d.Type {
+		case DT_PX:
+			sizes[i] = d.Amount
+		case DT_EM:
+			sizes[i] = d.Amount * n.GetFont().Height
+		case DT_FR:
+			if fixed {
+				fracs += d.Amount
+				continue
+			}
+			sizes[i] = n.trackContentSize(i, horizontal)
+			auto[i] = true
+		default:
+			sizes[i] = n.trackContentSize(i, horizontal)
+			auto[i] = true
+		}
+	}
+
+	n.growSpannedTracks(sizes, auto, gap, horizontal)
+	for _, size := range sizes {
+		used += size
+	}
+
+	if fracs > 0 {
+		free := Max(available-used-gap*float32(count-1), 0)
+		for i := range sizes {
+			if i < len(tracks) && tracks[i].Type == DT_FR {
+				sizes[i] = free * tracks[i].Amount / fracs
+			}
+		}
+	}
+
+	return sizes
+}
+
+// Sizes the tracks of a LT_GRID node, and fits Fr sized children into
+// their cells. The subtrees of these children are resolved again, since
+// their size was only a guess until now.
+func (n *Node) resolveGrid() {
+	cols, rows := n.placeGridCells()
+
+	fixed_w := n.isWidthResolved && n.Size.W.Type != DT_CHILDREN
+	fixed_h := n.isHeightResolved && n.Size.H.Type != DT_CHILDREN
+	inner_w := n.RealSize.X - n.Padding.Left - n.Padding.Right
+	inner_h := n.RealSize.Y - n.Padding.Top - n.Padding.Bottom
+
+	n.gridCols = n.gridTracks(n.Columns, cols, inner_w, fixed_w, n.Gap.Column, true)
+	n.gridRows = n.gridTracks(n.Rows, rows, inner_h, fixed_h, n.Gap.Row, false)
+
+	for _, child := range n.flowChildren() {
+		c := child.gridCell
+		resized := false
+
+		if child.Size.W.Type == DT_FR {
+			child.setWidth(spanSize(n.gridCols, c.Col, c.ColSpan, n.Gap.Column))
+			resized = true
+		}
+
+		if child.Size.H.Type == DT_FR {
+			child.setHeight(spanSize(n.gridRows, c.Row, c.RowSpan, n.Gap.Row))
+			resized = true
+		}
+
+		if resized {
+			child.unresolveFr()
+			child.resolveUpwards()
+			child.resolveDownwards()
+		}
+	}
+}
+
+// Marks Fr sized descendants as unresolved, so that they
+// can be resolved again after the size of n changes.
+func (n *Node) unresolveFr() {
+	for _, child := range n.Children {
+		if child.Size.W.Type == DT_FR { child.isWidthResolved = false }
+		if child.Size.H.Type == DT_FR { child.isHeightResolved = false }
+		child.unresolveFr()
+	}
+}
+
+// Returns the total size of the tracks, including gaps.
+func trackSum(sizes []float32, gap float32) float32 {
+	return spanSize(sizes, 0, len(sizes), gap)
+}
+
+// Returns the offset of a track from the start of the grid.
+func trackOffset(sizes []float32, track int, gap float32) (offset float32) {
+	for i := 0; i < track && i < len(sizes); i++ {
+		offset += sizes[i] + gap
+	}
+	return offset
+}
+
+// Returns the size of span tracks starting at track, including the gaps between them.
+func spanSize(sizes []float32, track, span int, gap float32) (size float32) {
+	if span <= 0 { return 0 }
+	for i := track; i < track+span && i < len(sizes); i++ {
+		size += sizes[i]
+	}
+	return size + gap*float32(span-1)
+}
@@ -0,0 +1,121 @@
+package ui
+
+import (
+	"strings"
+	. "github.com/glupi-borna/soko/internal/platform"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// Returns true in the frame in which the key combo (e.g. "Escape", "Ctrl+K")
+// was pressed.
+func KeyPressed(combo string) bool { return Platform.ComboPressed(combo) }
+
+// Returns true while the key combo is held down.
+func KeyDown(combo string) bool { return Platform.ComboDown(combo) }
+
+// Returns true in the frame in which the key combo was released.
+func KeyReleased(combo string) bool { return Platform.ComboReleased(combo) }
+
+type Modifiers struct {
+	Ctrl, Shift, Alt, Super bool
+}
+
+// Returns the modifier keys that are currently held.
+func GetModifiers() Modifiers {
+	km := Platform.KeyMods()
+	return Modifiers{
+		Ctrl:  km&KM_CTRL != 0,
+		Shift: km&KM_SHIFT != 0,
+		Alt:   km&KM_ALT != 0,
+		Super: km&KM_SUPER != 0,
+	}
+}
+
+func mouseButton(name string) uint8 {
+	switch strings.ToLower(name) {
+	case "left": return sdl.BUTTON_LEFT
+	case "middle": return sdl.BUTTON_MIDDLE
+	case "right": return sdl.BUTTON_RIGHT
+	case "x1": return sdl.BUTTON_X1
+	case "x2": return sdl.BUTTON_X2
+	default:
+		println("Unknown mouse button:", name)
+		return 0
+	}
+}
+
+func MousePressed(btn string) bool  { return Platform.MousePressed(mouseButton(btn)) }
+func MouseReleased(btn string) bool { return Platform.MouseReleased(mouseButton(btn)) }
+
+// Returns true while the mouse button is held down.
+func MouseDown(btn string) bool {
+	b := mouseButton(btn)
+	return Platform.MousePressed(b) || Platform.MouseDown(b)
+}
+
+// Returns the mouse position relative to the given node,
+// or relative to the window if the node is nil.
+func MousePos(n *Node) (float32, float32) {
+	if n == nil {
+		return Platform.MousePos.X, Platform.MousePos.Y
+	}
+	return n.MouseOffset()
+}
+
+// Returns the mouse movement since the last frame.
+func MouseDelta() (float32, float32) {
+	return Platform.MouseDelta.X, Platform.MouseDelta.Y
+}
+
+// Returns the scroll wheel movement since the last frame.
+func Wheel() (float32, float32) {
+	return Platform.WheelDelta.X, Platform.WheelDelta.Y
+}
+
+// Returns the text typed since the last frame.
+func TypedText() string {
+	return Platform.TextInput
+}
+
+// Returns true while a node that takes typed text (e.g. a TextInput)
+// has the keyboard focus.
+func Typing() bool { return CurrentUI.typing }
+
+// Returns true if the key combo types a character,
+// e.g. "m" or "Shift+1", but not "Escape" or "Ctrl+M".
+func typesText(kc KeyCombo) bool {
+	if kc.Mods&^KM_SHIFT != 0 { return false }
+	key := rune(sdl.GetKeyFromScancode(sdl.Scancode(kc.Key)))
+	return key >= ' ' && key <= '~'
+}
+
+// Calls fn if the key combo was pressed this frame.
+// Returns true if the shortcut was triggered. Combos that type
+// text are ignored while a text input has the focus.
+func Shortcut(combo string, fn func()) bool {
+	if !KeyPressed(combo) { return false }
+	kc, err := ParseKeyCombo(combo)
+	if err == nil && CurrentUI.typing && typesText(kc) { return false }
+	if fn != nil { fn() }
+	return true
+}
+
+var inputVars = map[string]any{
+	"KeyPressed":    KeyPressed,
+	"KeyDown":       KeyDown,
+	"KeyReleased":   KeyReleased,
+	"Modifiers":     GetModifiers,
+	"MousePressed":  MousePressed,
+	"MouseDown":     MouseDown,
+	"MouseReleased": MouseReleased,
+	"MousePos":      MousePos,
+	"MouseDelta":    MouseDelta,
+	"Wheel":         Wheel,
+	"Text":          TypedText,
+	"Typing":        Typing,
+}
+
+var WidgetVars = map[string]any{
+	"Input":    inputVars,
+	"Shortcut": Shortcut,
+}
@@ -0,0 +1,397 @@
+package ui
+
+import (
+	. "github.com/glupi-borna/soko/internal/platform"
+	. "github.com/glupi-borna/soko/internal/utils"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+type MenuItem struct {
+	// Returned by the Lua ContextMenu when the item is activated
+	ID    string
+	Label string
+	// Path of an image that is drawn before the label
+	Icon     string
+	Disabled bool
+	// Checkable items show a mark while they are Checked
+	Checkable bool
+	Checked   bool
+	// Drawn as a line between items, the other fields are ignored
+	Separator bool
+	// Items of the submenu, which opens when the item is hovered
+	Items []MenuItem
+	// Called by the Lua ContextMenu when the item is activated
+	Callback func()
+}
+
+func (item *MenuItem) enabled() bool {
+	return !item.Separator && !item.Disabled
+}
+
+type ContextMenuState struct {
+	Open bool
+	// Placement of the menu (see Node.RelativeTo)
+	relativeTo     string
+	anchor, offset V2
+	// Highlighted item (or -1) of each open menu. A submenu is open
+	// when the item highlighted in the menu above it has Items.
+	highlight []int
+	// Focused node when the menu was opened, focused again when it closes
+	returnFocus string
+	// Item under the mouse in this frame and in the last frame. Hovering
+	// an item highlights it, but only when the mouse gets to it, so that
+	// the mouse does not fight the keyboard.
+	hovered, prevHovered string
+}
+
+// Returns the items of the menu at level.
+func (s *ContextMenuState) menuAt(items []MenuItem, level int) []MenuItem {
+	for _, i := range s.highlight[:level] {
+		items = items[i].Items
+	}
+	return items
+}
+
+// Closes the submenus that no longer exist, e.g.
+// because the items changed since the last frame.
+func (s *ContextMenuState) validate(items []MenuItem) {
+	for level := 0; level < len(s.highlight); level++ {
+		i := s.highlight[level]
+		if i >= len(items) || (i >= 0 && !items[i].enabled()) {
+			i = -1
+			s.highlight[level] = -1
+		}
+		if i == -1 || len(items[i].Items) == 0 {
+			s.highlight = s.highlight[:level+1]
+			return
+		}
+		items = items[i].Items
+	}
+}
+
+func (s *ContextMenuState) open(relative_to string, anchor, offset V2, highlight int) {
+	// Opening the menu again keeps the node that had the focus before it
+	if !s.Open { s.returnFocus = CurrentUI.Focus }
+	s.Open = true
+	s.relativeTo = relative_to
+	s.anchor, s.offset = anchor, offset
+	s.highlight = append(s.highlight[:0], highlight)
+}
+
+// Closes the menu, and focuses the node that was focused
+// before it was opened, if restore_focus is true.
+func (s *ContextMenuState) close(restore_focus bool) {
+	s.Open = false
+	s.highlight = s.highlight[:0]
+	if restore_focus { CurrentUI.Focus = s.returnFocus }
+	s.returnFocus = ""
+}
+
+// Highlights the item in the menu at level, which
+// closes deeper menus, and opens its submenu.
+func (s *ContextMenuState) highlightItem(level, i int, item *MenuItem, submenu_highlight int) {
+	s.highlight = append(s.highlight[:level], i)
+	if len(item.Items) > 0 { s.highlight = append(s.highlight, submenu_highlight) }
+}
+
+// Returns the next enabled item after i in the direction dir, wrapping
+// around at the ends. Returns i if there are no other enabled items.
+func nextMenuItem(items []MenuItem, i, dir int) int {
+	for step := 1; step <= len(items); step++ {
+		j := ((i+step*dir)%len(items) + len(items)) % len(items)
+		if items[j].enabled() { return j }
+	}
+	return i
+}
+
+// Applies the keyboard input of this frame to the deepest open menu.
+// Returns the item that was activated, or nil.
+func (s *ContextMenuState) handleKeys(items []MenuItem) *MenuItem {
+	level := len(s.highlight) - 1
+	menu := s.menuAt(items, level)
+	i := s.highlight[level]
+	var item *MenuItem
+	if i >= 0 { item = &menu[i] }
+
+	switch {
+	case Platform.ComboPressed("Up"):
+		s.highlight[level] = nextMenuItem(menu, Max(i, 0), -1)
+	case Platform.ComboPressed("Down"):
+		s.highlight[level] = nextMenuItem(menu, i, 1)
+	case Platform.ComboPressed("Left"):
+		if level > 0 { s.highlight = s.highlight[:level] }
+	case Platform.ComboPressed("Escape"):
+		if level > 0 {
+			s.highlight = s.highlight[:level]
+		} else {
+			s.close(true)
+		}
+	case Platform.ComboPressed("Right"), Platform.ComboPressed("Return"),
+		Platform.ComboPressed("Keypad Enter"), Platform.ComboPressed("Space"):
+		if item == nil { break }
+		if len(item.Items) > 0 {
+			s.highlightItem(level, i, item, nextMenuItem(item.Items, -1, 1))
+		} else if !Platform.ComboPressed("Right") {
+			return item
+		}
+	default:
+		return nil
+	}
+
+	CurrentUI.ConsumeNav()
+	return nil
+}
+
+// Returns the bounds of the display that the window
+// is on, relative to the window, if they are known.
+func displayBounds() (sdl.FRect, bool) {
+	if Platform.Window == nil { return sdl.FRect{}, false }
+	bounds, err := Platform.TargetDisplayBounds()
+	if err != nil { return sdl.FRect{}, false }
+	wx, wy := Platform.Window.GetPosition()
+	return sdl.FRect{
+		X: float32(bounds.X - wx), Y: float32(bounds.Y - wy),
+		W: float32(bounds.W), H: float32(bounds.H),
+	}, true
+}
+
+// Moves the menu into the display, once it is positioned like any
+// absolute node, and before the hit test, so that the mouse finds
+// the menu where it is drawn.
+func menuPostLayout(n *Node) {
+	b, ok := displayBounds()
+	fitToDisplay(n, b, ok)
+}
+
+// Moves the menu into the display bounds b, if they are known. Menus
+// that do not fit on the right open to the left of their item (or of
+// the point where they were opened), and menus that do not fit below
+// are moved up.
+func fitToDisplay(n *Node, b sdl.FRect, known bool) {
+	if known {
+		if n.Pos.X+n.RealSize.X > b.X+b.W {
+			if n.Type == "menu" {
+				n.Pos.X = n.Parent.Pos.X - n.RealSize.X - n.Offset.X
+			} else {
+				n.Pos.X -= n.RealSize.X
+			}
+		}
+		n.Pos.Y = Min(n.Pos.Y, b.Y+b.H-n.RealSize.Y)
+	}
+	// The window can only grow to the right and down
+	n.Pos.X = Max(n.Pos.X, 0)
+	n.Pos.Y = Max(n.Pos.Y, 0)
+}
+
+// The menu does not react to the mouse itself, its items do.
+func menuUpdateFn(n *Node) {
+	n.UpdateChildren()
+}
+
+func menuRenderFn(n *Node) {
+	drawNodeRectBg(n.Pos, n.RealSize, n.GetStyle(), false)
+}
+
+func menuItemRenderFn(n *Node) {
+	drawNodeRectBg(n.Pos, n.RealSize, n.GetStyle(), NodeState[CheckState](n).Checked)
+}
+
+// Labels are highlighted with their item, instead of with the Active node.
+func menuLabelRenderFn(n *Node) {
+	drawTextNode(n, NodeState[CheckState](n.Parent).Checked)
+}
+
+func menuSeparatorRenderFn(n *Node) {
+	Platform.SetColor(n.GetStyle().Border.Normal)
+	Platform.DrawRectFilled(n.Pos.X+n.Padding.Left, n.Pos.Y+n.Padding.Top, n.RealSize.X-n.Padding.xPadding(), 1)
+}
+
+// Draws a dot while the item is checked.
+func menuCheckRenderFn(n *Node) {
+	if !NodeState[CheckState](n).Checked { return }
+	r := n.RealSize.X * .2
+	c := n.center()
+	Platform.SetColor(n.GetStyle().Foreground.Normal)
+	Platform.DrawRoundRectFilled(c.X-r, c.Y-r, r*2, r*2, r)
+}
+
+// Draws the arrow of an item with a submenu.
+func menuArrowRenderFn(n *Node) {
+	size := n.RealSize.X * .5
+	x := n.Pos.X + n.RealSize.X*.25
+	y := n.Pos.Y + n.RealSize.Y*.5 - size
+	Platform.SetColor(n.GetStyle().Foreground.Normal)
+	for i := float32(0); i < size; i++ {
+		Platform.DrawRectFilled(x+i, y+i, 1, size*2-i*2)
+	}
+}
+
+// Builds the items of the menu at level into the menu node, and the
+// submenu that is open in it. Adds the menu nodes to menus. Returns
+// the item that was clicked, or nil.
+func (s *ContextMenuState) buildMenu(menu *Node, items []MenuItem, level int, menus *[]*Node) *MenuItem {
+	*menus = append(*menus, menu)
+	menu.Layout = LT_VERTICAL
+	menu.Style = &MenuStyle
+	menu.Padding = Padding1(4)
+	menu.Size.W = ChildrenSize()
+	menu.Size.H = ChildrenSize()
+	menu.RenderFn = menuRenderFn
+	menu.UpdateFn = menuUpdateFn
+	menu.PostLayout = menuPostLayout
+
+	// Columns are as wide in every item, so that they line up
+	f := menu.GetFont()
+	mark := Platform.LineHeight(f)
+	var label_w float32
+	checks, icons, arrows := false, false, false
+	for _, item := range items {
+		label_w = Max(label_w, Platform.MeasureText(f, item.Label).X)
+		checks = checks || item.Checkable
+		icons = icons || item.Icon != ""
+		arrows = arrows || len(item.Items) > 0
+	}
+
+	item_padding := Padding2(8, 3)
+	item_gap := float32(6)
+	content_w := label_w
+	if checks { content_w += mark + item_gap }
+	if icons { content_w += mark + item_gap }
+	if arrows { content_w += mark*.5 + item_gap }
+
+	var clicked *MenuItem
+	for i := range items {
+		item := &items[i]
+		if item.Separator {
+			sep := CurrentUI.Push("menu_separator")
+			sep.Padding = Padding2(item_padding.Left, 3)
+			sep.Size.W = Px(content_w)
+			sep.Size.H = Px(1)
+			sep.RenderFn = menuSeparatorRenderFn
+			CurrentUI.Pop(sep)
+			continue
+		}
+
+		row := CurrentUI.Push("menu_item")
+		row.Layout = LT_HORIZONTAL
+		row.Padding = item_padding
+		row.Gap = Gap1(item_gap)
+		row.Size.W = ChildrenSize()
+		row.Size.H = ChildrenSize()
+		row.Style = &MenuItemStyle
+		if item.Disabled { row.Style = &MenuDisabledItemStyle }
+		row.RenderFn = menuItemRenderFn
+		NodeState[CheckState](row).Checked = i == s.highlight[level]
+
+		if checks {
+			check := CurrentUI.Push("menu_check")
+			check.Size.W = Px(mark)
+			check.Size.H = Px(mark)
+			check.Padding = Padding1(0)
+			check.RenderFn = menuCheckRenderFn
+			NodeState[CheckState](check).Checked = item.Checkable && item.Checked
+			CurrentUI.Pop(check)
+		}
+		if icons && item.Icon != "" {
+			icon := Image(item.Icon)
+			icon.Size.W = Px(mark)
+			icon.Size.H = Px(mark)
+			icon.Padding = Padding1(0)
+		} else if icons {
+			Invisible(Px(mark))
+		}
+
+		label := Text(item.Label)
+		label.Size.W = Px(label_w)
+		label.RenderFn = menuLabelRenderFn
+
+		if len(item.Items) > 0 {
+			arrow := CurrentUI.Push("menu_arrow")
+			arrow.Size.W = Px(mark * .5)
+			arrow.Size.H = Px(mark)
+			arrow.Padding = Padding1(0)
+			arrow.RenderFn = menuArrowRenderFn
+			CurrentUI.Pop(arrow)
+		} else if arrows {
+			Invisible(Px(mark * .5))
+		}
+
+		if item.enabled() && row.HasMouse() {
+			s.hovered = row.UID
+			if s.prevHovered != row.UID { s.highlightItem(level, i, item, -1) }
+			if Platform.MouseReleased(sdl.BUTTON_LEFT) && len(item.Items) == 0 { clicked = item }
+		}
+
+		if len(item.Items) > 0 && level+1 < len(s.highlight) && s.highlight[level] == i {
+			sub := CurrentUI.Push("menu")
+			sub.Position = P_ABSOLUTE
+			sub.Anchor = V2{X: 1}
+			sub.Offset = V2{X: menu.Padding.Right, Y: -menu.Padding.Top}
+			if c := s.buildMenu(sub, item.Items, level+1, menus); c != nil { clicked = c }
+			CurrentUI.Pop(sub)
+		}
+
+		CurrentUI.Pop(row)
+	}
+
+	return clicked
+}
+
+// Opens a menu of items when the target node is right-clicked (or when
+// the Menu key, or Shift+F10, is pressed while the target is focused).
+// Items with Items open a submenu when they are hovered. The menu has
+// keyboard focus while it is open, and closes when an item is activated,
+// with Escape, or a click outside of it. Returns the activated item, or nil.
+func ContextMenu(target *Node, items []MenuItem) *MenuItem {
+	n := CurrentUI.Push("context_menu")
+	defer CurrentUI.Pop(n)
+
+	n.Position = P_ABSOLUTE
+	n.Padding = Padding1(0)
+	n.RenderFn = nil
+	state := NodeState[ContextMenuState](n)
+
+	opened := false
+	if target.HasMouse() && Platform.MousePressed(sdl.BUTTON_RIGHT) {
+		state.open("root", V2{}, Platform.MousePos, -1)
+		opened = true
+	} else if target.HasFocus() && (Platform.ComboPressed("Application") ||
+		Platform.ComboPressed("Menu") || Platform.ComboPressed("Shift+F10")) {
+		state.open(target.UID, V2{Y: 1}, V2{}, nextMenuItem(items, -1, 1))
+		opened = true
+	}
+
+	if state.Open && len(items) == 0 { state.close(n.HasFocus()) }
+	// Tab, or a click on another node, moved the focus away
+	if state.Open && !opened && !n.HasFocus() { state.close(false) }
+	if !state.Open {
+		// Keeps the closed menu out of the way of the mouse
+		n.RelativeTo = "root"
+		n.Offset = V2{X: -1, Y: -1}
+		return nil
+	}
+
+	state.validate(items)
+	n.Flags.Focusable = true
+	n.RelativeTo = state.relativeTo
+	n.Anchor = state.anchor
+	n.Offset = state.offset
+	if opened { CurrentUI.SetFocus(n) }
+
+	activated := state.handleKeys(items)
+	if !state.Open { return nil }
+
+	state.prevHovered, state.hovered = state.hovered, ""
+	menus := make([]*Node, 0, len(state.highlight))
+	if clicked := state.buildMenu(n, items, 0, &menus); clicked != nil { activated = clicked }
+
+	pressed := Platform.MousePressed(sdl.BUTTON_LEFT) ||
+		Platform.MousePressed(sdl.BUTTON_RIGHT) ||
+		Platform.MousePressed(sdl.BUTTON_MIDDLE)
+	outside := true
+	for _, menu := range menus {
+		if menu.HasMouse() { outside = false }
+	}
+	if activated != nil || (pressed && outside && !opened) { state.close(true) }
+	return activated
+}
@@ -0,0 +1,75 @@
+package ui
+
+import (
+	"testing"
+	. "github.com/glupi-borna/soko/internal/platform"
+	. "github.com/glupi-borna/soko/internal/utils"
+	. "github.com/glupi-borna/soko/tests"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+func TestNextMenuItem(t *testing.T) {
+	items := []MenuItem{{Label: "Cut"}, {Separator: true}, {Label: "Paste", Disabled: true}, {Label: "Delete"}}
+
+	AssertEq(nextMenuItem(items, -1, 1), 0, t)
+	AssertEq(nextMenuItem(items, 0, 1), 3, t)
+	// Wraps around at the ends
+	AssertEq(nextMenuItem(items, 3, 1), 0, t)
+	AssertEq(nextMenuItem(items, 0, -1), 3, t)
+	// Without other enabled items, the highlight stays
+	AssertEq(nextMenuItem(items[:3], 0, 1), 0, t)
+}
+
+func TestValidateMenu(t *testing.T) {
+	items := []MenuItem{
+		{Label: "View", Items: []MenuItem{{Label: "Zoom", Items: []MenuItem{{Label: "In"}}}}},
+		{Label: "Quit"},
+	}
+
+	s := ContextMenuState{highlight: []int{0, 0, 0}}
+	s.validate(items)
+	AssertEq(len(s.highlight), 3, t)
+
+	// The submenus of an item without Items are closed
+	s = ContextMenuState{highlight: []int{1, 0}}
+	s.validate(items)
+	AssertEq(len(s.highlight), 1, t)
+
+	// Items that no longer exist are not highlighted
+	s = ContextMenuState{highlight: []int{0, 4, 0}}
+	s.validate(items)
+	AssertEq(len(s.highlight), 2, t)
+	AssertEq(s.highlight[1], -1, t)
+}
+
+func TestMenuFitsDisplay(t *testing.T) {
+	ui := MakeUI()
+	CurrentUI = ui
+	root := testNode("root", nil, Px(100), Px(100))
+	ui.Root = root
+	// Opened close to the bottom right corner of the display
+	menu := testNode("context_menu", root, Px(50), Px(40))
+	menu.Position = P_ABSOLUTE
+	menu.Offset = V2{X: 80, Y: 70}
+	menu.Layout = LT_VERTICAL
+	item := testNode("item", menu, Px(50), Px(20))
+	display := sdl.FRect{W: 120, H: 100}
+	menu.PostLayout = func(n *Node) { fitToDisplay(n, display, true) }
+
+	layout(root)
+	ui.floating = []*Node{menu}
+	ui.resolveFloating()
+
+	// Flipped to the left of the point, and moved up
+	AssertEq(menu.Pos.X, 30, t)
+	AssertEq(menu.Pos.Y, 60, t)
+	AssertEq(item.Pos.Y, 60, t)
+
+	// The mouse finds the items where they are drawn
+	Platform.MousePos = V2{X: 40, Y: 65}
+	ui.hitTest()
+	AssertEq(ui.hovered, item, t)
+	Platform.MousePos = V2{X: 90, Y: 75}
+	ui.hitTest()
+	AssertEq(ui.hovered, root, t)
+}
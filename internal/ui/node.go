@@ -6,6 +6,7 @@ import (
 	. "github.com/glupi-borna/soko/internal/utils"
 	"github.com/veandco/go-sdl2/sdl"
 	"strconv"
+	"sort"
 	"fmt"
 )
 
@@ -20,6 +21,7 @@ const (
 	DT_CHILDREN
 	DT_LARGEST_SIBLING
 	DT_SKIP
+	DT_PERCENT
 )
 
 type Dimension struct {
@@ -35,6 +37,8 @@ func (d *Dimension) String() string {
 		return "text"
 	case DT_FR:
 		return FloatStr(d.Amount) + "fr"
+	case DT_PERCENT:
+		return FloatStr(d.Amount) + "%"
 	case DT_EM:
 		return FloatStr(d.Amount) + "em"
 	case DT_PX:
@@ -54,7 +58,15 @@ func LargestSibling() Dimension   { return Dimension{Type: DT_LARGEST_SIBLING} }
 func FitText() Dimension          { return Dimension{Type: DT_TEXT} }
 func Auto() Dimension             { return Dimension{Type: DT_AUTO} }
 
-type Size struct{ W, H Dimension }
+// Percentage of the parent's content box
+func Percent(amount float32) Dimension { return Dimension{Type: DT_PERCENT, Amount: amount} }
+
+type Size struct {
+	W, H Dimension
+	// Constraints that the resolved size is clamped to.
+	// Auto (the zero value) means no constraint.
+	MinW, MaxW, MinH, MaxH Dimension
+}
 
 func (s *Size) String() string {
 	x := s.W.String()
@@ -67,10 +79,41 @@ type LAYOUT_TYPE uint8
 const (
 	LT_VERTICAL LAYOUT_TYPE = iota
 	LT_HORIZONTAL
+	LT_WRAP // Horizontal, breaking onto a new line when out of width
+	LT_GRID // Cells of Node.Columns and Node.Rows tracks
+	LT_STACK // On top of each other, sharing the content box
+)
+
+type POSITION uint8
+
+const (
+	P_FLOW POSITION = iota // Positioned by the layout of the parent
+	// Positioned relative to Node.RelativeTo, outside of the
+	// parent's layout, and drawn above everything else
+	P_ABSOLUTE
 )
 
+// Placement of a node in a grid. Col and Row start at 1,
+// nodes with a zero Col or Row are placed automatically.
+type CellType struct {
+	Col, Row, ColSpan, RowSpan int
+}
+
+func Cell(col, row int) CellType {
+	return CellType{col, row, 1, 1}
+}
+
+func CellSpan(col, row, col_span, row_span int) CellType {
+	return CellType{col, row, col_span, row_span}
+}
+
 type NodeFlags struct {
 	Focusable bool
+	// Children are clipped to the content rect, and can
+	// not be hovered outside of it
+	Clip bool
+	// Takes typed text while it has the focus (see Typing)
+	TextInput bool
 }
 
 type Node struct {
@@ -82,7 +125,49 @@ type Node struct {
 	Children []*Node
 	Style    *Style
 	Padding  PaddingType
-	Text     string
+	Gap      GapType
+	Justify  JUSTIFY // Children positioning along the layout direction
+	// Cross axis alignment of this node, overrides Style.Align
+	// unless it is A_AUTO (the default), which inherits it
+	AlignSelf ALIGN
+	Text      string
+	// Maximum number of lines that Text is wrapped to (0 for no limit)
+	MaxLines int
+	// Horizontal alignment of the lines of Text
+	TextAlign ALIGN
+	// Styled text, used instead of Text by RichText
+	Spans []Span
+
+	// Grid tracks, used by LT_GRID
+	Columns, Rows []Dimension
+	// Placement in the parent grid
+	Cell CellType
+	// Horizontal alignment within the parent grid cell or stack
+	JustifySelf ALIGN
+	// Nodes with a higher ZIndex are drawn over their siblings,
+	// and take the mouse from them
+	ZIndex int
+
+	Position POSITION
+	// For absolute nodes: "" for the parent, "root", or the UID of a node
+	RelativeTo string
+	// Point on the RelativeTo node, as a fraction of its size,
+	// at which the Origin of this node is placed
+	Anchor V2
+	// Point on this node, as a fraction of its size
+	Origin V2
+	// Added to the absolute position
+	Offset V2
+
+	// Calculated lines of Text
+	lines []string
+	// Calculated lines of Spans
+	richLines []richLine
+
+	// Calculated track sizes of a grid
+	gridCols, gridRows []float32
+	// Calculated placement in the parent grid (0 based)
+	gridCell CellType
 
 	// Semantic size
 	Size Size
@@ -102,6 +187,10 @@ type Node struct {
 	// Called before layout is done
 	PreLayout func(*Node)
 
+	// Called after an absolute node has been positioned, before
+	// the hit test. Can move the node, its children follow.
+	PostLayout func(*Node)
+
 	// Called after the position and size of the Node
 	// have been resolved, after the node's parents
 	// have been rendered, and before the node's children
@@ -120,6 +209,11 @@ type Node struct {
 
 	// The UI State object associated with this node
 	UI *UI_State
+
+	// User-supplied key that the UID is derived from
+	key string
+	// ID scope (see UI_State.PushID) that the node was created in
+	scope string
 }
 
 // Currently does the same as MakeNode, but
@@ -129,12 +223,32 @@ func GetNode(t string, parent *Node) *Node {
 	return n
 }
 
+// Builds the UID from the key of the node if it has one, and from
+// its index among unkeyed siblings of the same type and ID scope
+// otherwise, so that keyed siblings do not shift the index.
 func buildNodeUID(n *Node) string {
-	if n.Parent != nil {
-		return n.Parent.UID + "." + n.Type + strconv.Itoa(n.Parent.CountChildrenOfType(n.Type))
-	} else {
+	if n.Parent == nil {
 		return n.Type
 	}
+
+	if n.key != "" {
+		if DEBUG {
+			for _, sibling := range n.Parent.Children {
+				if sibling != n && sibling.Type == n.Type && sibling.key == n.key && sibling.scope == n.scope {
+					Log("Duplicate key", strconv.Quote(n.key), "for", n.Type, "in", n.Parent.UID)
+				}
+			}
+		}
+		return n.Parent.UID + "." + n.scope + n.Type + "#" + n.key
+	}
+
+	count := 0
+	for _, sibling := range n.Parent.Children {
+		if sibling.Type == n.Type && sibling.key == "" && sibling.scope == n.scope {
+			count++
+		}
+	}
+	return n.Parent.UID + "." + n.scope + n.Type + strconv.Itoa(count)
 }
 
 func MakeNode(t string, parent *Node) *Node {
@@ -148,7 +262,11 @@ func MakeNode(t string, parent *Node) *Node {
 		UpdateFn: defaultUpdateFn,
 		Padding:  Padding1(2),
 		UI:       CurrentUI,
+		key:      CurrentUI.nextKey,
+		scope:    CurrentUI.idScope,
+		AlignSelf: A_AUTO,
 	}
+	CurrentUI.nextKey = ""
 
 	if n.Parent != nil {
 		n.Parent.Children = append(n.Parent.Children, &n)
@@ -174,11 +292,25 @@ func (n *Node) sdlRect() sdl.Rect {
 	}
 }
 
+// Returns the rectangle inside of the padding of the node.
+func (n *Node) contentRect() sdl.Rect {
+	rect := n.sdlRect()
+	rect.X += int32(n.Padding.Left)
+	rect.Y += int32(n.Padding.Top)
+	rect.W -= int32(n.Padding.xPadding())
+	rect.H -= int32(n.Padding.yPadding())
+	return rect
+}
+
 func (n *Node) preLayout() {
 	if n.PreLayout != nil {
 		n.PreLayout(n)
 	}
 
+	if n.Position != P_FLOW && n.UI != nil {
+		n.UI.floating = append(n.UI.floating, n)
+	}
+
 	for _, child := range n.Children {
 		child.preLayout()
 	}
@@ -193,22 +325,13 @@ func defaultUpdateFn(n *Node) {
 				CurrentUI.SetActive(n, false)
 				if Platform.MousePressed(sdl.BUTTON_LEFT) {
 					CurrentUI.SetHot(n, false)
+					CurrentUI.SetFocus(n)
 				}
 				if Platform.MouseReleased(sdl.BUTTON_LEFT) {
 					CurrentUI.SetHot(nil, false)
 				}
 			}
 		}
-
-		if CurrentUI.Mode == IM_KBD && CurrentUI.Active == n.UID {
-			// xkbd := Btof(KeyboardPressed(sdl.SCANCODE_RIGHT)) - Btof(KeyboardPressed(sdl.SCANCODE_LEFT))
-			// ykbd := Btof(KeyboardPressed(sdl.SCANCODE_DOWN)) - Btof(KeyboardPressed(sdl.SCANCODE_UP))
-			/*
-				if xkbd != 0 && ykbd != 0 {
-					_UI.MoveActive(n, xkbd, ykbd)
-				}
-			*/
-		}
 	}
 }
 
@@ -280,13 +403,15 @@ func (n *Node) Render() {
 		n.RenderFn(n)
 	}
 
-	for _, child := range n.Children {
+	for _, child := range n.paintOrder() {
 		child.Render()
 	}
 
 	if n.PostRenderFn != nil {
 		n.PostRenderFn(n)
 	}
+
+	drawFocusRing(n)
 }
 
 func (n *Node) GetStyle() *Style {
@@ -300,12 +425,12 @@ func (n *Node) GetStyle() *Style {
 }
 
 func (n *Node) xFracs() float32 {
-	if n.Layout == LT_VERTICAL {
+	if n.Layout != LT_HORIZONTAL {
 		return 1
 	}
 
 	var count float32 = 0
-	for _, child := range n.Children {
+	for _, child := range n.flowChildren() {
 		cw := child.Size.W
 		if cw.Type == DT_FR {
 			count += cw.Amount
@@ -315,12 +440,12 @@ func (n *Node) xFracs() float32 {
 }
 
 func (n *Node) yFracs() float32 {
-	if n.Layout == LT_HORIZONTAL {
+	if n.Layout != LT_VERTICAL {
 		return 1
 	}
 
 	var count float32 = 0
-	for _, child := range n.Children {
+	for _, child := range n.flowChildren() {
 		ch := child.Size.H
 		if ch.Type == DT_FR {
 			count += ch.Amount
@@ -330,9 +455,11 @@ func (n *Node) yFracs() float32 {
 }
 
 var autoMap = map[string]Size{
-	"text":   {FitText(), FitText()},
-	"row":    {Fr(1), ChildrenSize()},
-	"column": {ChildrenSize(), Fr(1)},
+	"text":   {W: FitText(), H: FitText()},
+	"row":    {W: Fr(1), H: ChildrenSize()},
+	"column": {W: ChildrenSize(), H: Fr(1)},
+	"wrap":   {W: Fr(1), H: ChildrenSize()},
+	"grid":   {W: Fr(1), H: ChildrenSize()},
 }
 
 func resolveAuto(n *Node) {
@@ -363,31 +490,27 @@ func (n *Node) resolveStandalone() {
 
 	switch n.Size.W.Type {
 	case DT_PX:
-		n.RealSize.X = n.Size.W.Amount + n.Padding.xPadding()
-		n.isWidthResolved = true
+		n.setWidth(n.Size.W.Amount + n.Padding.xPadding())
 
 	case DT_EM:
-		n.RealSize.X = n.Size.W.Amount*n.GetFont().Height + n.Padding.xPadding()
-		n.isWidthResolved = true
+		n.setWidth(n.Size.W.Amount*n.GetFont().Height + n.Padding.xPadding())
 
 	case DT_TEXT:
-		n.RealSize.X = Platform.TextWidth(n.Text) + n.Padding.xPadding()
-		n.isWidthResolved = true
+		n.layoutText()
+		n.setWidth(n.textWidth() + n.Padding.xPadding())
 	}
 
 
 	switch n.Size.H.Type {
 	case DT_PX:
-		n.RealSize.Y = n.Size.H.Amount + n.Padding.yPadding()
-		n.isHeightResolved = true
+		n.setHeight(n.Size.H.Amount + n.Padding.yPadding())
 
 	case DT_EM:
-		n.RealSize.Y = n.Size.H.Amount*n.GetFont().Height + n.Padding.yPadding()
-		n.isHeightResolved = true
+		n.setHeight(n.Size.H.Amount*n.GetFont().Height + n.Padding.yPadding())
 
 	case DT_TEXT:
-		n.RealSize.Y = Platform.TextHeight(n.Text) + n.Padding.yPadding()
-		n.isHeightResolved = true
+		n.layoutText()
+		n.setHeight(n.textHeight() + n.Padding.yPadding())
 	}
 
 	for _, child := range n.Children {
@@ -397,80 +520,229 @@ func (n *Node) resolveStandalone() {
 
 // Resolves parent-dependent sizes
 func (n *Node) resolveUpwards() {
+	// Absolute nodes do not share the space with their siblings
+	if n.Position != P_FLOW && n.Parent != nil {
+		if !n.isWidthResolved && n.Size.W.Type == DT_FR {
+			n.setWidth(n.parentRemainingWidth()*n.Size.W.Amount + n.Padding.xPadding())
+		}
+		if !n.isHeightResolved && n.Size.H.Type == DT_FR {
+			n.setHeight(n.parentRemainingHeight()*n.Size.H.Amount + n.Padding.yPadding())
+		}
+	}
+
 	if !n.isWidthResolved && n.Size.W.Type == DT_FR {
 		pw := n.parentRemainingWidth()
-		fracs := n.Parent.xFracs()
-		fracw := pw / fracs
-
-		for _, child := range n.Parent.Children {
-			if child.Size.W.Type == DT_FR {
-				child.RealSize.X = fracw*child.Size.W.Amount + child.Padding.xPadding()
-				child.isWidthResolved = true
+		if n.Parent.Layout == LT_HORIZONTAL {
+			distributeFr(n.Parent.flowChildren(), pw, true)
+		} else {
+			for _, child := range n.Parent.flowChildren() {
+				if child.Size.W.Type == DT_FR {
+					child.setWidth(pw*child.Size.W.Amount + child.Padding.xPadding())
+				}
 			}
 		}
 	}
 
 	if !n.isHeightResolved && n.Size.H.Type == DT_FR {
 		ph := n.parentRemainingHeight()
-		fracs := n.Parent.yFracs()
-		frach := ph / fracs
-
-		for _, child := range n.Parent.Children {
-			if child.Size.H.Type == DT_FR {
-				child.RealSize.Y = frach*child.Size.H.Amount + child.Padding.yPadding()
-				child.isHeightResolved = true
+		if n.Parent.Layout == LT_VERTICAL {
+			distributeFr(n.Parent.flowChildren(), ph, false)
+		} else {
+			for _, child := range n.Parent.flowChildren() {
+				if child.Size.H.Type == DT_FR {
+					child.setHeight(ph*child.Size.H.Amount + child.Padding.yPadding())
+				}
 			}
 		}
 	}
 
+	// Percentages are resolved before the children distribute
+	// Fr space, so that they are not part of the remaining space.
+	for _, child := range n.Children {
+		if child.Size.W.Type == DT_PERCENT {
+			child.setWidth(child.percentWidth(child.Size.W.Amount) + child.Padding.xPadding())
+		}
+		if child.Size.H.Type == DT_PERCENT {
+			child.setHeight(child.percentHeight(child.Size.H.Amount) + child.Padding.yPadding())
+		}
+	}
+
 	for _, child := range n.Children {
 		child.resolveUpwards()
 	}
 }
 
+// Shares space among the Fr sized children along one axis. Children
+// whose size constraints are hit are frozen at the clamped size,
+// and the space that is left is shared among the others.
+func distributeFr(children []*Node, space float32, horizontal bool) {
+	dim := func(c *Node) Dimension {
+		if horizontal { return c.Size.W }
+		return c.Size.H
+	}
+	padding := func(c *Node) float32 {
+		if horizontal { return c.Padding.xPadding() }
+		return c.Padding.yPadding()
+	}
+
+	sizes := make(map[*Node]float32)
+	frozen := make(map[*Node]bool)
+
+	for {
+		var fracs float32 = 0
+		remaining := space
+		for _, child := range children {
+			if dim(child).Type != DT_FR { continue }
+			if frozen[child] {
+				remaining -= sizes[child] - padding(child)
+			} else {
+				fracs += dim(child).Amount
+			}
+		}
+		if fracs <= 0 { break }
+
+		per_frac := Max(remaining, 0) / fracs
+		violated := false
+		for _, child := range children {
+			if dim(child).Type != DT_FR || frozen[child] { continue }
+			size := per_frac*dim(child).Amount + padding(child)
+			if horizontal {
+				sizes[child] = child.clampWidth(size)
+			} else {
+				sizes[child] = child.clampHeight(size)
+			}
+			if sizes[child] != size {
+				frozen[child] = true
+				violated = true
+			}
+		}
+		if !violated { break }
+	}
+
+	for child, size := range sizes {
+		if horizontal {
+			child.setWidth(size)
+		} else {
+			child.setHeight(size)
+		}
+	}
+}
+
 // Resolves child-dependent sizes
 func (n *Node) resolveDownwards() {
 	for _, child := range n.Children {
 		child.resolveDownwards()
 	}
 
+	n.fitTextHeight()
+
+	if n.Layout == LT_GRID {
+		n.resolveGrid()
+		if n.Size.W.Type == DT_CHILDREN {
+			n.setWidth(trackSum(n.gridCols, n.Gap.Column) + n.Padding.xPadding())
+		}
+		if n.Size.H.Type == DT_CHILDREN {
+			n.setHeight(trackSum(n.gridRows, n.Gap.Row) + n.Padding.yPadding())
+		}
+		return
+	}
+
 	if n.Size.W.Type == DT_CHILDREN {
 		switch n.Layout {
-		case LT_HORIZONTAL:
-			n.RealSize.X = n.childSum(nodeRealX) + n.Padding.xPadding()
-			n.isWidthResolved = true
+		case LT_HORIZONTAL, LT_WRAP:
+			n.setWidth(n.childSum(nodeRealX) + n.Padding.xPadding())
 
-		case LT_VERTICAL:
-			n.RealSize.X = n.childMax(nodeRealX) + n.Padding.xPadding()
-			n.isWidthResolved = true
+		case LT_VERTICAL, LT_STACK:
+			n.setWidth(n.childMax(nodeRealX) + n.Padding.xPadding())
 		}
 	}
 
 	if n.Size.H.Type == DT_CHILDREN {
 		switch n.Layout {
 		case LT_VERTICAL:
-			n.RealSize.Y = n.childSum(nodeRealY) + n.Padding.yPadding()
-			n.isHeightResolved = true
+			n.setHeight(n.childSum(nodeRealY) + n.Padding.yPadding())
 
-		case LT_HORIZONTAL:
-			n.RealSize.Y = n.childMax(nodeRealY) + n.Padding.yPadding()
-			n.isHeightResolved = true
+		case LT_HORIZONTAL, LT_STACK:
+			n.setHeight(n.childMax(nodeRealY) + n.Padding.yPadding())
+
+		case LT_WRAP:
+			n.setHeight(n.wrapHeight() + n.Padding.yPadding())
 		}
 	}
 }
 
+// Returns the width at which Text is wrapped, or 0 if it is not
+// wrapped. Text that is sized by its width is wrapped at Size.MaxW.
+func (n *Node) textWrapWidth() float32 {
+	if n.Size.W.Type != DT_TEXT && n.isWidthResolved {
+		return Max(n.RealSize.X-n.Padding.xPadding(), 1)
+	}
+	if w, ok := n.widthConstraint(n.Size.MaxW); ok {
+		return Max(w-n.Padding.xPadding(), 1)
+	}
+	return 0
+}
+
+func (n *Node) layoutText() {
+	if n.Spans != nil {
+		n.richLines = n.layoutSpans(n.textWrapWidth())
+		return
+	}
+	n.lines = Platform.WrapText(n.GetFont(), n.Text, n.textWrapWidth(), n.MaxLines)
+}
+
+func (n *Node) textWidth() (w float32) {
+	if n.Spans != nil {
+		for _, line := range n.richLines {
+			w = Max(w, line.width)
+		}
+		return w
+	}
+
+	f := n.GetFont()
+	for _, line := range n.lines {
+		w = Max(w, Platform.MeasureText(f, line).X)
+	}
+	return w
+}
+
+func (n *Node) textHeight() float32 {
+	if n.Spans != nil {
+		var h float32 = 0
+		for _, line := range n.richLines {
+			h += line.height
+		}
+		return h
+	}
+
+	if len(n.lines) == 0 { return 0 }
+	f := n.GetFont()
+	return Platform.MeasureText(f, n.lines[0]).Y + float32(len(n.lines)-1)*Platform.LineHeight(f)
+}
+
+// Wraps Text again once the width of the node is known, if the
+// height is fit to the text but the width is not.
+func (n *Node) fitTextHeight() {
+	if n.Size.H.Type != DT_TEXT || n.Size.W.Type == DT_TEXT { return }
+	n.layoutText()
+	n.setHeight(n.textHeight() + n.Padding.yPadding())
+}
+
 func realWidth(n *Node) float32  { return n.RealSize.X }
 func realHeight(n *Node) float32 { return n.RealSize.Y }
 
 func (n *Node) resolveViolations() {
 	if n.Size.W.Type == DT_LARGEST_SIBLING {
-		n.RealSize.X = n.Parent.childMax(realWidth) + n.Padding.xPadding()
+		n.setWidth(n.Parent.childMax(realWidth) + n.Padding.xPadding())
 	}
 
 	if n.Size.H.Type == DT_LARGEST_SIBLING {
-		n.RealSize.Y = n.Parent.childMax(realHeight) + n.Padding.yPadding()
+		n.setHeight(n.Parent.childMax(realHeight) + n.Padding.yPadding())
 	}
 
+	// The width might have been shrunk by the parent
+	n.fitTextHeight()
+
 	var w, h float32
 
 	switch n.Layout {
@@ -486,28 +758,40 @@ func (n *Node) resolveViolations() {
 	total_width := w + n.Padding.Left + n.Padding.Right
 	total_height := h + n.Padding.Top + n.Padding.Bottom
 
-	if n.Layout == LT_HORIZONTAL && total_width > n.RealSize.X {
-		fracs := n.xFracs()
-		if fracs > 0 {
-			fracdec := (total_width - n.RealSize.X) / fracs
-			for _, child := range n.Children {
-				if child.Size.W.Type == DT_FR {
-					child.RealSize.X -= fracdec * child.Size.W.Amount
-				}
+	// Fr children are shrunk to make the children fit. The space is
+	// shared again, because constraints can stop some from shrinking.
+	if n.Layout == LT_HORIZONTAL && total_width > n.RealSize.X && n.xFracs() > 0 {
+		space := n.RealSize.X - total_width
+		for _, child := range n.flowChildren() {
+			if child.Size.W.Type == DT_FR {
+				space += child.RealSize.X - child.Padding.xPadding()
 			}
 		}
+		distributeFr(n.flowChildren(), space, true)
 	}
 
-	if n.Layout == LT_VERTICAL && total_height > n.RealSize.Y {
-		fracs := n.yFracs()
-		if fracs > 0 {
-			fracdec := (total_height - n.RealSize.Y) / fracs
-			for _, child := range n.Children {
-				if child.Size.H.Type == DT_FR {
-					child.RealSize.Y -= fracdec * child.Size.H.Amount
-				}
+	if n.Layout == LT_VERTICAL && total_height > n.RealSize.Y && n.yFracs() > 0 {
+		space := n.RealSize.Y - total_height
+		for _, child := range n.flowChildren() {
+			if child.Size.H.Type == DT_FR {
+				space += child.RealSize.Y - child.Padding.yPadding()
 			}
 		}
+		distributeFr(n.flowChildren(), space, false)
+	}
+
+	// The width might have been shrunk by the parent,
+	// which can push children onto new lines.
+	if n.Layout == LT_WRAP && n.Size.H.Type == DT_CHILDREN {
+		n.setHeight(n.wrapHeight() + n.Padding.yPadding())
+	}
+
+	// Likewise, Fr tracks have to be fit into the new size.
+	if n.Layout == LT_GRID {
+		n.resolveGrid()
+		if n.Size.H.Type == DT_CHILDREN {
+			n.setHeight(trackSum(n.gridRows, n.Gap.Row) + n.Padding.yPadding())
+		}
 	}
 
 	for _, child := range n.Children {
@@ -531,16 +815,85 @@ func nodeRealY(n *Node) float32 {
 	}
 }
 
+// Returns the gap between children along the layout direction.
+func (n *Node) mainGap() float32 {
+	switch n.Layout {
+	case LT_HORIZONTAL, LT_WRAP:
+		return n.Gap.Column
+	case LT_VERTICAL:
+		return n.Gap.Row
+	}
+	return 0
+}
+
+// Splits the children of a LT_WRAP node into lines that
+// fit into its width.
+func (n *Node) wrapLines() [][]*Node {
+	lines := make([][]*Node, 0, 1)
+	children := n.flowChildren()
+	if len(children) == 0 { return lines }
+
+	// Before the width is known, everything fits on one line
+	if !n.isWidthResolved { return append(lines, children) }
+
+	max_width := n.RealSize.X - n.Padding.Left - n.Padding.Right
+	start := 0
+	var width float32 = 0
+
+	for i, child := range children {
+		w := nodeRealX(child)
+		if i > start && width+n.Gap.Column+w > max_width {
+			lines = append(lines, children[start:i])
+			start = i
+			width = w
+			continue
+		}
+		if i > start { width += n.Gap.Column }
+		width += w
+	}
+
+	return append(lines, children[start:])
+}
+
+func lineHeight(line []*Node) (h float32) {
+	for _, child := range line {
+		h = max(h, nodeRealY(child))
+	}
+	return h
+}
+
+// Returns the height of the wrapped lines of a LT_WRAP node, including gaps.
+func (n *Node) wrapHeight() float32 {
+	lines := n.wrapLines()
+	if len(lines) == 0 { return 0 }
+
+	var h float32 = 0
+	for _, line := range lines {
+		h += lineHeight(line)
+	}
+	return h + n.Gap.Row*float32(len(lines)-1)
+}
+
+// Returns the total space taken up by gaps between children.
+func (n *Node) gapSum() float32 {
+	count := len(n.flowChildren())
+	if count < 2 {
+		return 0
+	}
+	return n.mainGap() * float32(count-1)
+}
+
+// Sums the values along the layout direction, including gaps.
 func (n *Node) childSum(fn func(*Node) float32) float32 {
 	var sum float32 = 0
-	for _, child := range n.Children {
+	for _, child := range n.flowChildren() {
 		sum += fn(child)
 	}
-	return sum
+	return sum + n.gapSum()
 }
 
 func (n *Node) childMax(fn func(*Node) float32) (val float32) {
-	for _, child := range n.Children {
+	for _, child := range n.flowChildren() {
 		cv := fn(child)
 		if cv > val {
 			val = cv
@@ -568,9 +921,77 @@ func (n *Node) parentHeight() float32 {
 		return float32(tdb.H)
 	}
 	if n.Parent.isHeightResolved {
-		return n.Parent.RealSize.X
+		return n.Parent.RealSize.Y
 	}
-	return n.Parent.parentWidth()
+	return n.Parent.parentHeight()
+}
+
+// Returns the given percentage of the parent's content width.
+func (n *Node) percentWidth(percent float32) float32 {
+	w := n.parentWidth()
+	if n.Parent != nil { w -= n.Parent.Padding.Left + n.Parent.Padding.Right }
+	return Max(w, 0) * percent / 100
+}
+
+// Returns the given percentage of the parent's content height.
+func (n *Node) percentHeight(percent float32) float32 {
+	h := n.parentHeight()
+	if n.Parent != nil { h -= n.Parent.Padding.Top + n.Parent.Padding.Bottom }
+	return Max(h, 0) * percent / 100
+}
+
+// Returns the width that a constraint amounts to,
+// or false if the constraint is not set.
+func (n *Node) widthConstraint(d Dimension) (float32, bool) {
+	switch d.Type {
+	case DT_PX:
+		return d.Amount + n.Padding.xPadding(), true
+	case DT_EM:
+		return d.Amount*n.GetFont().Height + n.Padding.xPadding(), true
+	case DT_PERCENT:
+		return n.percentWidth(d.Amount) + n.Padding.xPadding(), true
+	}
+	return 0, false
+}
+
+// Returns the height that a constraint amounts to,
+// or false if the constraint is not set.
+func (n *Node) heightConstraint(d Dimension) (float32, bool) {
+	switch d.Type {
+	case DT_PX:
+		return d.Amount + n.Padding.yPadding(), true
+	case DT_EM:
+		return d.Amount*n.GetFont().Height + n.Padding.yPadding(), true
+	case DT_PERCENT:
+		return n.percentHeight(d.Amount) + n.Padding.yPadding(), true
+	}
+	return 0, false
+}
+
+// Clamps the width to Size.MinW and Size.MaxW. The maximum wins
+// if the constraints contradict each other.
+func (n *Node) clampWidth(w float32) float32 {
+	if lower, ok := n.widthConstraint(n.Size.MinW); ok { w = Max(w, lower) }
+	if upper, ok := n.widthConstraint(n.Size.MaxW); ok { w = Min(w, upper) }
+	return w
+}
+
+// Clamps the height to Size.MinH and Size.MaxH. The maximum wins
+// if the constraints contradict each other.
+func (n *Node) clampHeight(h float32) float32 {
+	if lower, ok := n.heightConstraint(n.Size.MinH); ok { h = Max(h, lower) }
+	if upper, ok := n.heightConstraint(n.Size.MaxH); ok { h = Min(h, upper) }
+	return h
+}
+
+func (n *Node) setWidth(w float32) {
+	n.RealSize.X = n.clampWidth(w)
+	n.isWidthResolved = true
+}
+
+func (n *Node) setHeight(h float32) {
+	n.RealSize.Y = n.clampHeight(h)
+	n.isHeightResolved = true
 }
 
 func (n *Node) parentRemainingWidth() float32 {
@@ -580,8 +1001,9 @@ func (n *Node) parentRemainingWidth() float32 {
 		return float32(tdb.W)
 	}
 	w := n.parentWidth() - n.Parent.Padding.Left - n.Parent.Padding.Right
-	if n.Parent.Layout == LT_HORIZONTAL {
-		for _, child := range n.Parent.Children {
+	if n.Parent.Layout == LT_HORIZONTAL && n.Position == P_FLOW {
+		w -= n.Parent.gapSum()
+		for _, child := range n.Parent.flowChildren() {
 			if child.isWidthResolved {
 				w -= child.RealSize.X
 			}
@@ -597,8 +1019,9 @@ func (n *Node) parentRemainingHeight() float32 {
 		return float32(tdb.H)
 	}
 	h := n.parentHeight() - n.Parent.Padding.Top - n.Parent.Padding.Bottom
-	if n.Parent.Layout == LT_VERTICAL {
-		for _, child := range n.Parent.Children {
+	if n.Parent.Layout == LT_VERTICAL && n.Position == P_FLOW {
+		h -= n.Parent.gapSum()
+		for _, child := range n.Parent.flowChildren() {
 			if child.isHeightResolved {
 				h -= child.RealSize.Y
 			}
@@ -611,24 +1034,21 @@ func (n *Node) resolvePos() {
 	if n.Parent == nil {
 		n.Pos.X = 0
 		n.Pos.Y = 0
-	} else {
-		s := n.GetStyle()
-		if s != nil {
-			switch s.Align {
-			case A_CENTER:
-				switch n.Parent.Layout {
-				case LT_HORIZONTAL:
-					n.Pos.Y = n.Parent.Pos.Y + n.Parent.RealSize.Y*.5 - n.RealSize.Y*.5
-				case LT_VERTICAL:
-					n.Pos.X = n.Parent.Pos.X + n.Parent.RealSize.X*.5 - n.RealSize.X*.5
-				}
-			case A_END:
-				switch n.Parent.Layout {
-				case LT_HORIZONTAL:
-					n.Pos.Y = n.Parent.Pos.Y + n.Parent.RealSize.Y - n.RealSize.Y
-				case LT_VERTICAL:
-					n.Pos.X = n.Parent.Pos.X + n.Parent.RealSize.X - n.RealSize.X
-				}
+	} else if n.Position == P_FLOW {
+		switch n.alignment() {
+		case A_CENTER:
+			switch n.Parent.Layout {
+			case LT_HORIZONTAL:
+				n.Pos.Y = n.Parent.Pos.Y + n.Parent.RealSize.Y*.5 - n.RealSize.Y*.5
+			case LT_VERTICAL:
+				n.Pos.X = n.Parent.Pos.X + n.Parent.RealSize.X*.5 - n.RealSize.X*.5
+			}
+		case A_END:
+			switch n.Parent.Layout {
+			case LT_HORIZONTAL:
+				n.Pos.Y = n.Parent.Pos.Y + n.Parent.RealSize.Y - n.RealSize.Y
+			case LT_VERTICAL:
+				n.Pos.X = n.Parent.Pos.X + n.Parent.RealSize.X - n.RealSize.X
 			}
 		}
 	}
@@ -636,34 +1056,288 @@ func (n *Node) resolvePos() {
 	n.Pos.Y += n.Translation.Y
 	n.Pos.X += n.Translation.X
 
-	var offset float32 = 0
+	if n.Layout == LT_WRAP {
+		n.resolveWrapPos()
+		return
+	}
+
+	if n.Layout == LT_GRID {
+		n.resolveGridPos()
+		return
+	}
+
+	if n.Layout == LT_STACK {
+		x := n.Pos.X + n.Padding.Left
+		y := n.Pos.Y + n.Padding.Top
+		w := n.RealSize.X - n.Padding.Left - n.Padding.Right
+		h := n.RealSize.Y - n.Padding.Top - n.Padding.Bottom
+		for _, child := range n.flowChildren() {
+			child.alignInBox(x, y, w, h)
+			child.resolvePos()
+		}
+		return
+	}
+
 	xmul := Btof(n.Layout == LT_HORIZONTAL)
 	ymul := Btof(n.Layout == LT_VERTICAL)
+	offset, gap := n.justifyOffsets()
 
-	for _, child := range n.Children {
+	for _, child := range n.flowChildren() {
 		child.Pos.X = n.Pos.X + n.Padding.Left + offset*xmul
 		child.Pos.Y = n.Pos.Y + n.Padding.Top + offset*ymul
 		offset += child.RealSize.X * xmul
 		offset += child.RealSize.Y * ymul
+		offset += gap
 		child.resolvePos()
 	}
 }
 
+// Returns the cross axis alignment of the node.
+func (n *Node) alignment() ALIGN {
+	if n.AlignSelf != A_AUTO { return n.AlignSelf }
+	s := n.GetStyle()
+	if s != nil { return s.Align }
+	return A_START
+}
+
+// Positions the children of a LT_WRAP node line by line. Justify
+// applies to each line, and Align positions children within their line.
+func (n *Node) resolveWrapPos() {
+	max_width := n.RealSize.X - n.Padding.Left - n.Padding.Right
+	y := n.Pos.Y + n.Padding.Top
+
+	for _, line := range n.wrapLines() {
+		var width float32 = 0
+		for _, child := range line {
+			width += nodeRealX(child)
+		}
+		width += n.Gap.Column * float32(len(line)-1)
+
+		offset, gap := justify(n.Justify, max_width-width, len(line), n.Gap.Column)
+		line_height := lineHeight(line)
+
+		for _, child := range line {
+			child.Pos.X = n.Pos.X + n.Padding.Left + offset
+			child.Pos.Y = y
+			switch child.alignment() {
+			case A_CENTER:
+				child.Pos.Y += (line_height - child.RealSize.Y) * .5
+			case A_END:
+				child.Pos.Y += line_height - child.RealSize.Y
+			}
+			offset += child.RealSize.X + gap
+			child.resolvePos()
+		}
+
+		y += line_height + n.Gap.Row
+	}
+}
+
+// Positions the children of a LT_GRID node in their cells, aligned
+// by JustifySelf horizontally and by AlignSelf vertically.
+func (n *Node) resolveGridPos() {
+	for _, child := range n.flowChildren() {
+		c := child.gridCell
+		x := n.Pos.X + n.Padding.Left + trackOffset(n.gridCols, c.Col, n.Gap.Column)
+		y := n.Pos.Y + n.Padding.Top + trackOffset(n.gridRows, c.Row, n.Gap.Row)
+		w := spanSize(n.gridCols, c.Col, c.ColSpan, n.Gap.Column)
+		h := spanSize(n.gridRows, c.Row, c.RowSpan, n.Gap.Row)
+		child.alignInBox(x, y, w, h)
+		child.resolvePos()
+	}
+}
+
+// Positions the node inside of the box, aligned by
+// JustifySelf horizontally and by AlignSelf vertically.
+func (n *Node) alignInBox(x, y, w, h float32) {
+	switch n.JustifySelf {
+	case A_CENTER:
+		x += (w - n.RealSize.X) * .5
+	case A_END:
+		x += w - n.RealSize.X
+	}
+
+	switch n.alignment() {
+	case A_CENTER:
+		y += (h - n.RealSize.Y) * .5
+	case A_END:
+		y += h - n.RealSize.Y
+	}
+
+	n.Pos.X = x
+	n.Pos.Y = y
+}
+
+// Returns the offset of the first child and the spacing between
+// children along the layout direction, according to n.Justify.
+func (n *Node) justifyOffsets() (float32, float32) {
+	gap := n.mainGap()
+	count := len(n.flowChildren())
+	if n.Justify == J_START || count == 0 { return 0, gap }
+
+	var free float32
+	switch n.Layout {
+	case LT_HORIZONTAL:
+		free = n.RealSize.X - n.Padding.Left - n.Padding.Right - n.childSum(nodeRealX)
+	case LT_VERTICAL:
+		free = n.RealSize.Y - n.Padding.Top - n.Padding.Bottom - n.childSum(nodeRealY)
+	default:
+		return 0, gap
+	}
+
+	return justify(n.Justify, free, count, gap)
+}
+
+// Distributes free space among children that are
+// separated by gap.
+func justify(j JUSTIFY, free float32, children int, gap float32) (float32, float32) {
+	if children == 0 { return 0, gap }
+	count := float32(children)
+
+	switch j {
+	case J_CENTER:
+		return free * .5, gap
+	case J_END:
+		return free, gap
+	}
+
+	// Distributing negative space would make children overlap
+	if free < 0 { return 0, gap }
+
+	switch j {
+	case J_SPACE_BETWEEN:
+		if count < 2 { return 0, gap }
+		return 0, gap + free/(count-1)
+	case J_SPACE_AROUND:
+		space := free / count
+		return space * .5, gap + space
+	case J_SPACE_EVENLY:
+		space := free / (count + 1)
+		return space, gap + space
+	}
+	return 0, gap
+}
+
 func (n *Node) UpdateChildren() {
 	for _, child := range n.Children {
 		child.UpdateFn(child)
 	}
 }
 
-func (n *Node) HasMouse() bool {
-	mx, my := Platform.MousePos.X, Platform.MousePos.Y
+// Returns the children that are positioned by the layout of n,
+// leaving out absolutely positioned ones.
+func (n *Node) flowChildren() []*Node {
+	for i, child := range n.Children {
+		if child.Position == P_FLOW { continue }
+
+		// Only allocate when there are absolute children
+		flow := make([]*Node, i, len(n.Children))
+		copy(flow, n.Children[:i])
+		for _, child := range n.Children[i+1:] {
+			if child.Position == P_FLOW { flow = append(flow, child) }
+		}
+		return flow
+	}
+	return n.Children
+}
+
+// Returns the children in the order in which they are drawn,
+// sorted by ZIndex. Later siblings are drawn over earlier ones.
+// Absolutely positioned children are drawn in the overlay pass.
+func (n *Node) paintOrder() []*Node {
+	children := n.flowChildren()
+	sorted := true
+	for i := 1; i < len(children); i++ {
+		if children[i].ZIndex < children[i-1].ZIndex {
+			sorted = false
+			break
+		}
+	}
+	if sorted { return children }
+
+	order := make([]*Node, len(children))
+	copy(order, children)
+	sort.SliceStable(order, func(i, j int) bool { return order[i].ZIndex < order[j].ZIndex })
+	return order
+}
+
+func (n *Node) contains(x, y float32) bool {
 	x1, y1 := n.Pos.X, n.Pos.Y
 	x2, y2 := x1+n.RealSize.X, y1+n.RealSize.Y
 
-	return (mx >= x1 &&
-		mx <= x2 &&
-		my >= y1 &&
-		my <= y2)
+	return (x >= x1 &&
+		x <= x2 &&
+		y >= y1 &&
+		y <= y2)
+}
+
+// Returns true if the point lies inside of the clip rect that the
+// node sets for its children (if it clips them).
+func (n *Node) clipContains(x, y float32) bool {
+	if !n.Flags.Clip { return true }
+	r := n.contentRect()
+	return (x >= float32(r.X) &&
+		x <= float32(r.X+r.W) &&
+		y >= float32(r.Y) &&
+		y <= float32(r.Y+r.H))
+}
+
+// Returns the topmost node under the point in the subtree of n,
+// or nil if there is none. Children are tested in reverse paint
+// order, and only inside of the clip rect of n. Absolutely positioned
+// nodes are left out, since they are drawn in the overlay pass.
+func (n *Node) hitTest(x, y float32) *Node {
+	if n.clipContains(x, y) {
+		children := n.paintOrder()
+		for i := len(children) - 1; i >= 0; i-- {
+			hit := children[i].hitTest(x, y)
+			if hit != nil { return hit }
+		}
+	}
+	if n.contains(x, y) { return n }
+	return nil
+}
+
+// Returns the node that an absolute node is positioned relative to.
+func (n *Node) relativeNode() *Node {
+	switch n.RelativeTo {
+	case "":
+		return n.Parent
+	case "root":
+		return n.UI.Root
+	}
+	target := n.UI.Root.Find(func(c *Node) bool { return c.UID == n.RelativeTo })
+	if target == nil {
+		n.debug(n.Type, "RelativeTo: no node with UID", n.RelativeTo)
+		return n.Parent
+	}
+	return target
+}
+
+// Positions an absolute node relative to its RelativeTo node,
+// which must already be positioned. The window only grows to the
+// right and down, so the node is kept at non-negative coordinates.
+func (n *Node) resolveAbsolutePos() {
+	target := n.relativeNode()
+	if target == nil { target = n.UI.Root }
+	n.Pos.X = target.Pos.X + target.RealSize.X*n.Anchor.X - n.RealSize.X*n.Origin.X + n.Offset.X
+	n.Pos.Y = target.Pos.Y + target.RealSize.Y*n.Anchor.Y - n.RealSize.Y*n.Origin.Y + n.Offset.Y
+	n.Pos.X = Max(n.Pos.X, 0)
+	n.Pos.Y = Max(n.Pos.Y, 0)
+	n.resolvePos()
+}
+
+// Returns true if the node, or one of its descendants, is the
+// topmost node under the mouse (see UI_State.hitTest). Nodes
+// are compared by UID, so this also works while building the
+// tree, with the result of the previous frame.
+func (n *Node) HasMouse() bool {
+	for h := CurrentUI.hovered; h != nil; h = h.Parent {
+		if h.UID == n.UID { return true }
+		// Overlays are not over their ancestors, except for the root
+		if h.Position != P_FLOW { return n.UID == CurrentUI.Root.UID }
+	}
+	return false
 }
 
 func (n *Node) IsChildOf(t *Node) bool {
@@ -688,6 +1362,21 @@ func (n *Node) IsChildOfUID(uid string) bool {
 	return false
 }
 
+// Returns the first node in the subtree (including n itself),
+// in depth-first order, for which pred returns true.
+func (n *Node) Find(pred func(*Node) bool) *Node {
+	if pred(n) {
+		return n
+	}
+	for _, child := range n.Children {
+		found := child.Find(pred)
+		if found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
 func (n *Node) Index() int {
 	if n.Parent == nil {
 		return -1
@@ -700,7 +1389,9 @@ func (n *Node) Index() int {
 	return -1
 }
 
+// Returns true if the node was clicked, or activated with the keyboard.
 func (n *Node) Clicked() bool {
+	if n.Activated() { return true }
 	return n.Flags.Focusable && n.UID == CurrentUI.Hot && Platform.MouseReleased(sdl.BUTTON_LEFT)
 }
 
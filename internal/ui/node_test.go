@@ -0,0 +1,494 @@
+package ui
+
+import (
+	"testing"
+	. "github.com/glupi-borna/soko/internal/utils"
+	. "github.com/glupi-borna/soko/tests"
+)
+
+// Makes a node with the given size and no padding.
+func testNode(t string, parent *Node, w, h Dimension) *Node {
+	if CurrentUI == nil { CurrentUI = MakeUI() }
+	n := MakeNode(t, parent)
+	n.Padding = PaddingType{}
+	n.Size = Size{W: w, H: h}
+	return n
+}
+
+func layout(root *Node) {
+	root.resolveStandalone()
+	root.resolveUpwards()
+	root.resolveDownwards()
+	root.resolveViolations()
+	root.resolvePos()
+}
+
+func TestResolveStandalone(t *testing.T) {
+	root := testNode("root", nil, Px(100), Px(50))
+	root.Padding = Padding2(5, 0)
+	child := testNode("row", root, Fr(1), ChildrenSize())
+	wrap := testNode("wrap", root, Px(60), ChildrenSize())
+	wrap.Layout = LT_WRAP
+	for i := 0; i < 3; i++ {
+		testNode("item", wrap, Px(30), Px(10))
+	}
+
+	root.resolveStandalone()
+
+	AssertEq(root.RealSize.X, 110, t)
+	AssertEq(root.isWidthResolved, true, t)
+	AssertEq(root.isHeightResolved, true, t)
+	AssertEq(child.isWidthResolved, false, t)
+	AssertEq(child.isHeightResolved, false, t)
+
+	// The lines of a wrap are known once its width is,
+	// but its height waits for the children
+	AssertEq(wrap.RealSize.X, 60, t)
+	AssertEq(wrap.isHeightResolved, false, t)
+	AssertEq(len(wrap.wrapLines()), 2, t)
+}
+
+func TestResolveUpwards(t *testing.T) {
+	root := testNode("row", nil, Px(100), Px(20))
+	root.Layout = LT_HORIZONTAL
+	root.Gap = Gap(10)
+	fixed := testNode("fixed", root, Px(20), Px(20))
+	a := testNode("a", root, Fr(1), Px(20))
+	b := testNode("b", root, Fr(1), Px(20))
+
+	root.resolveStandalone()
+	root.resolveUpwards()
+
+	AssertEq(fixed.RealSize.X, 20, t)
+	AssertEq(a.RealSize.X, 30, t)
+	AssertEq(b.RealSize.X, 30, t)
+
+	// Fr children of a wrap take a share of the whole
+	// line, because they can move onto a line of their own
+	wrap := testNode("wrap", nil, Px(100), ChildrenSize())
+	wrap.Layout = LT_WRAP
+	wrap.Gap = Gap(10)
+	testNode("fixed", wrap, Px(20), Px(20))
+	half := testNode("half", wrap, Fr(.5), Px(20))
+	full := testNode("full", wrap, Fr(1), Px(20))
+
+	wrap.resolveStandalone()
+	wrap.resolveUpwards()
+
+	AssertEq(half.RealSize.X, 50, t)
+	AssertEq(full.RealSize.X, 100, t)
+	AssertEq(len(wrap.wrapLines()), 2, t)
+}
+
+func TestResolveDownwards(t *testing.T) {
+	root := testNode("column", nil, ChildrenSize(), ChildrenSize())
+	root.Layout = LT_VERTICAL
+	root.Gap = Gap(5)
+	testNode("a", root, Px(30), Px(10))
+	testNode("b", root, Px(50), Px(10))
+
+	root.resolveStandalone()
+	root.resolveUpwards()
+	root.resolveDownwards()
+
+	AssertEq(root.RealSize.X, 50, t)
+	AssertEq(root.RealSize.Y, 25, t)
+
+	// A wrap is as tall as its lines, and its
+	// parent grows to fit it
+	column := testNode("column", nil, ChildrenSize(), ChildrenSize())
+	column.Layout = LT_VERTICAL
+	wrap := testNode("wrap", column, Px(70), ChildrenSize())
+	wrap.Layout = LT_WRAP
+	wrap.Gap = Gap(5)
+	for i := 0; i < 3; i++ {
+		testNode("item", wrap, Px(30), Px(10))
+	}
+
+	column.resolveStandalone()
+	column.resolveUpwards()
+	column.resolveDownwards()
+
+	AssertEq(wrap.RealSize.Y, 25, t)
+	AssertEq(column.RealSize.X, 70, t)
+	AssertEq(column.RealSize.Y, 25, t)
+}
+
+func TestResolveViolations(t *testing.T) {
+	root := testNode("row", nil, Px(100), Px(20))
+	root.Layout = LT_HORIZONTAL
+	flexible := testNode("flexible", root, Fr(1), Px(20))
+	children := testNode("children", root, ChildrenSize(), Px(20))
+	testNode("fixed", children, Px(60), Px(20))
+
+	root.resolveStandalone()
+	root.resolveUpwards()
+	root.resolveDownwards()
+	AssertEq(flexible.RealSize.X, 100, t)
+
+	root.resolveViolations()
+	AssertEq(flexible.RealSize.X, 40, t)
+	AssertEq(children.RealSize.X, 60, t)
+}
+
+func TestWrapLines(t *testing.T) {
+	root := testNode("wrap", nil, Px(100), ChildrenSize())
+	root.Layout = LT_WRAP
+	root.Gap = Gap(5, 10)
+	items := []*Node{}
+	for i := 0; i < 5; i++ {
+		items = append(items, testNode("item", root, Px(30), Px(20)))
+	}
+	items[1].Size.H = Px(30)
+
+	layout(root)
+
+	AssertEq(len(root.wrapLines()), 3, t)
+	AssertEq(root.RealSize.Y, 30+20+20+5*2, t)
+	AssertEq(items[1].Pos.X, 40, t)
+	AssertEq(items[2].Pos.X, 0, t)
+	AssertEq(items[2].Pos.Y, 35, t)
+	AssertEq(items[4].Pos.Y, 60, t)
+}
+
+func TestWrapChildrenWidth(t *testing.T) {
+	root := testNode("wrap", nil, ChildrenSize(), ChildrenSize())
+	root.Layout = LT_WRAP
+	root.Gap = Gap(10)
+	for i := 0; i < 3; i++ {
+		testNode("item", root, Px(30), Px(20))
+	}
+
+	layout(root)
+
+	AssertEq(len(root.wrapLines()), 1, t)
+	AssertEq(root.RealSize.X, 110, t)
+	AssertEq(root.RealSize.Y, 20, t)
+}
+
+func TestWrapAlign(t *testing.T) {
+	root := testNode("wrap", nil, Px(100), ChildrenSize())
+	root.Layout = LT_WRAP
+	root.Justify = J_CENTER
+	tall := testNode("tall", root, Px(30), Px(40))
+	center := testNode("center", root, Px(30), Px(20))
+	center.AlignSelf = A_CENTER
+	end := testNode("end", root, Px(30), Px(20))
+	end.AlignSelf = A_END
+
+	layout(root)
+
+	AssertEq(tall.Pos.X, 5, t)
+	AssertEq(center.Pos.Y, 10, t)
+	AssertEq(end.Pos.Y, 20, t)
+}
+
+func TestWrapShrunkByParent(t *testing.T) {
+	root := testNode("row", nil, Px(100), ChildrenSize())
+	root.Layout = LT_HORIZONTAL
+	wrap := testNode("wrap", root, Fr(1), ChildrenSize())
+	wrap.Layout = LT_WRAP
+	for i := 0; i < 3; i++ {
+		testNode("item", wrap, Px(30), Px(20))
+	}
+	sibling := testNode("sibling", root, ChildrenSize(), Px(20))
+	testNode("fixed", sibling, Px(40), Px(20))
+
+	layout(root)
+
+	AssertEq(wrap.RealSize.X, 60, t)
+	AssertEq(len(wrap.wrapLines()), 2, t)
+	AssertEq(wrap.RealSize.Y, 40, t)
+}
+
+func TestGridTracks(t *testing.T) {
+	root := testNode("grid", nil, Px(100), ChildrenSize())
+	root.Layout = LT_GRID
+	root.Columns = []Dimension{ChildrenSize(), Fr(1)}
+	root.Gap = Gap(5, 10)
+	testNode("label", root, Px(30), Px(10))
+	value := testNode("value", root, Fr(1), Px(10))
+	label := testNode("label", root, Px(50), Px(20))
+	last := testNode("value", root, Fr(1), Px(10))
+
+	layout(root)
+
+	AssertEq(root.gridCols[0], 50, t)
+	AssertEq(root.gridCols[1], 40, t)
+	AssertEq(value.RealSize.X, 40, t)
+	AssertEq(root.RealSize.Y, 35, t)
+	AssertEq(label.Pos.Y, 15, t)
+	AssertEq(last.Pos.X, 60, t)
+}
+
+func TestGridCells(t *testing.T) {
+	outer := testNode("column", nil, Px(100), Px(100))
+	root := testNode("grid", outer, ChildrenSize(), ChildrenSize())
+	root.Layout = LT_GRID
+	root.Columns = []Dimension{Px(20), Px(30), Fr(1)}
+	header := testNode("header", root, Fr(1), Px(10))
+	header.Cell = CellSpan(1, 1, 3, 1)
+	side := testNode("side", root, Px(10), Fr(1))
+	side.Cell = CellSpan(3, 2, 1, 2)
+	side.JustifySelf = A_END
+	a := testNode("a", root, Px(10), Px(10))
+	b := testNode("b", root, Px(10), Px(20))
+	c := testNode("c", root, Px(10), Px(10))
+	c.AlignSelf = A_CENTER
+
+	layout(outer)
+
+	AssertEq(len(root.gridRows), 3, t)
+	AssertEq(root.RealSize.X, 60, t)
+	AssertEq(header.RealSize.X, 60, t)
+	AssertEq(side.RealSize.Y, 30, t)
+	AssertEq(side.Pos.X, 50, t)
+	AssertEq(a.Pos.Y, 10, t)
+	AssertEq(b.Pos.X, 20, t)
+	AssertEq(c.Pos.Y, 30, t)
+}
+
+func TestGridInRow(t *testing.T) {
+	root := testNode("row", nil, Px(100), ChildrenSize())
+	root.Layout = LT_HORIZONTAL
+	grid := testNode("grid", root, Fr(1), ChildrenSize())
+	grid.Layout = LT_GRID
+	grid.Columns = []Dimension{Fr(1), Fr(1)}
+	cell := testNode("row", grid, Fr(1), Px(10))
+	cell.Layout = LT_HORIZONTAL
+	inner := testNode("inner", cell, Fr(1), Px(10))
+	sibling := testNode("sibling", root, ChildrenSize(), Px(10))
+	testNode("fixed", sibling, Px(40), Px(10))
+
+	layout(root)
+
+	AssertEq(grid.RealSize.X, 60, t)
+	AssertEq(cell.RealSize.X, 30, t)
+	AssertEq(inner.RealSize.X, 30, t)
+}
+
+func TestGridAutoSpan(t *testing.T) {
+	root := testNode("grid", nil, ChildrenSize(), ChildrenSize())
+	root.Layout = LT_GRID
+	root.Columns = []Dimension{Px(10), Px(10), Px(10)}
+	a := testNode("a", root, Px(10), Px(10))
+	a.Cell = Cell(2, 1)
+	wide := testNode("wide", root, Px(20), Px(10))
+	wide.Cell = CellSpan(0, 0, 2, 1)
+	b := testNode("b", root, Px(10), Px(10))
+	tall := testNode("tall", root, Px(10), Px(20))
+	tall.Cell = CellSpan(0, 0, 2, 2)
+	c := testNode("c", root, Px(10), Px(10))
+
+	layout(root)
+
+	// wide does not fit next to a, so it moves to the next row,
+	// and b follows it
+	AssertEq(wide.gridCell.Col, 0, t)
+	AssertEq(wide.gridCell.Row, 1, t)
+	AssertEq(wide.gridCell.ColSpan, 2, t)
+	AssertEq(b.gridCell.Col, 2, t)
+	AssertEq(b.gridCell.Row, 1, t)
+	AssertEq(tall.gridCell.Row, 2, t)
+	AssertEq(tall.gridCell.ColSpan, 2, t)
+	AssertEq(c.gridCell.Col, 2, t)
+	AssertEq(c.gridCell.Row, 2, t)
+	AssertEq(len(root.gridRows), 4, t)
+}
+
+func TestGridSpanContent(t *testing.T) {
+	root := testNode("grid", nil, ChildrenSize(), ChildrenSize())
+	root.Layout = LT_GRID
+	root.Columns = []Dimension{Px(10), ChildrenSize(), ChildrenSize()}
+	root.Gap = Gap(0, 5)
+	testNode("a", root, Px(10), Px(10))
+	testNode("b", root, Px(10), Px(10))
+	testNode("c", root, Px(10), Px(10))
+	wide := testNode("wide", root, Px(50), Px(10))
+	wide.Cell = CellSpan(1, 2, 3, 1)
+
+	layout(root)
+
+	// 50 = 10 + 5 + 15 + 5 + 15, only the content sized tracks grow
+	AssertEq(root.gridCols[0], 10, t)
+	AssertEq(root.gridCols[1], 15, t)
+	AssertEq(root.gridCols[2], 15, t)
+	AssertEq(root.RealSize.X, 50, t)
+	AssertEq(wide.RealSize.X, 50, t)
+}
+
+func TestStack(t *testing.T) {
+	root := testNode("stack", nil, ChildrenSize(), ChildrenSize())
+	root.Layout = LT_STACK
+	art := testNode("art", root, Px(40), Px(40))
+	badge := testNode("badge", root, Px(10), Px(10))
+	badge.JustifySelf = A_END
+	badge.ZIndex = 1
+	label := testNode("label", root, Px(20), Px(10))
+	label.JustifySelf = A_CENTER
+	label.AlignSelf = A_END
+
+	layout(root)
+
+	AssertEq(root.RealSize.X, 40, t)
+	AssertEq(root.RealSize.Y, 40, t)
+	AssertEq(badge.Pos.X, 30, t)
+	AssertEq(badge.Pos.Y, 0, t)
+	AssertEq(label.Pos.X, 10, t)
+	AssertEq(label.Pos.Y, 30, t)
+
+	order := root.paintOrder()
+	AssertEq(order[2], badge, t)
+	AssertEq(root.hitTest(35, 5), badge, t)
+	AssertEq(root.hitTest(5, 20), art, t)
+	AssertEq(root.hitTest(15, 35), label, t)
+}
+
+func TestHitTestClip(t *testing.T) {
+	window := testNode("scroll_window", nil, Px(50), Px(20))
+	window.Flags.Clip = true
+	view := testNode("scroll_view", window, ChildrenSize(), ChildrenSize())
+	view.Layout = LT_VERTICAL
+	first := testNode("item", view, Px(50), Px(20))
+	hidden := testNode("item", view, Px(50), Px(20))
+
+	layout(window)
+
+	AssertEq(hidden.Pos.Y, 20, t)
+	AssertEq(window.hitTest(10, 10), first, t)
+	AssertEq(window.hitTest(10, 30), nil, t)
+}
+
+func TestAbsolute(t *testing.T) {
+	root := testNode("column", nil, ChildrenSize(), ChildrenSize())
+	root.Layout = LT_VERTICAL
+	button := testNode("button", root, Px(20), Px(10))
+	popup := testNode("float", button, Px(50), Px(30))
+	popup.Position = P_ABSOLUTE
+	popup.Anchor = V2{X: 0, Y: 1}
+	popup.Offset = V2{X: 2, Y: 0}
+	after := testNode("after", root, Px(20), Px(10))
+	tip := testNode("float", after, Px(30), Px(10))
+	tip.Position = P_ABSOLUTE
+	tip.Origin = V2{X: 1, Y: 1}
+
+	layout(root)
+	popup.resolveAbsolutePos()
+	tip.resolveAbsolutePos()
+
+	AssertEq(root.RealSize.X, 20, t)
+	AssertEq(root.RealSize.Y, 20, t)
+	AssertEq(button.RealSize.X, 20, t)
+	AssertEq(popup.Pos.X, 2, t)
+	AssertEq(popup.Pos.Y, 10, t)
+	AssertEq(after.Pos.Y, 10, t)
+	// Would start at (-30, 0), left of the window
+	AssertEq(tip.Pos.X, 0, t)
+	AssertEq(tip.Pos.Y, 0, t)
+}
+
+func TestConstraints(t *testing.T) {
+	root := testNode("row", nil, Px(100), Px(20))
+	root.Layout = LT_HORIZONTAL
+	a := testNode("a", root, Fr(1), Px(20))
+	a.Size.MaxW = Px(20)
+	b := testNode("b", root, Fr(1), Px(20))
+	c := testNode("c", root, Percent(30), Percent(50))
+	text := testNode("text", root, Px(200), Px(20))
+	text.Size.MaxW = Percent(10)
+
+	root.resolveStandalone()
+	AssertEq(text.RealSize.X, 10, t)
+
+	root.resolveUpwards()
+	AssertEq(c.RealSize.X, 30, t)
+	AssertEq(c.RealSize.Y, 10, t)
+	AssertEq(a.RealSize.X, 20, t)
+	AssertEq(b.RealSize.X, 40, t)
+}
+
+func TestConstraintsViolations(t *testing.T) {
+	root := testNode("row", nil, Px(100), Px(20))
+	root.Layout = LT_HORIZONTAL
+	a := testNode("a", root, Fr(1), Px(20))
+	a.Size.MinW = Px(60)
+	b := testNode("b", root, Fr(1), Px(20))
+	children := testNode("children", root, ChildrenSize(), Px(20))
+	testNode("fixed", children, Px(40), Px(20))
+
+	layout(root)
+
+	AssertEq(a.RealSize.X, 60, t)
+	AssertEq(b.RealSize.X, 0, t)
+	AssertEq(children.Pos.X, 60, t)
+}
+
+func TestKeyedUID(t *testing.T) {
+	CurrentUI = MakeUI()
+	root := testNode("column", nil, Px(100), Px(100))
+
+	first := testNode("row", root, Px(10), Px(10))
+	CurrentUI.Key("spotify")
+	keyed := testNode("row", root, Px(10), Px(10))
+	second := testNode("row", root, Px(10), Px(10))
+
+	AssertEq(first.UID, "column.row1", t)
+	AssertEq(keyed.UID, "column.row#spotify", t)
+	AssertEq(second.UID, "column.row2", t)
+
+	CurrentUI.PushID("item")
+	scoped := testNode("row", root, Px(10), Px(10))
+	CurrentUI.PopID()
+	after := testNode("row", root, Px(10), Px(10))
+
+	AssertEq(scoped.UID, "column.item:row1", t)
+	AssertEq(after.UID, "column.row3", t)
+}
+
+type cleanupState struct{ cleaned *bool }
+
+func (s *cleanupState) Cleanup() { *s.cleaned = true }
+
+func TestStateSweep(t *testing.T) {
+	ui := MakeUI()
+	CurrentUI = ui
+	ui.StateTTL = 2
+	ui.Frame = 1
+
+	stale := testNode("stale", nil, Px(10), Px(10))
+	live := testNode("live", nil, Px(10), Px(10))
+	cleaned := false
+	NodeState[cleanupState](stale).cleaned = &cleaned
+	NodeState[SliderState](live).Perc = .5
+	Animate(1, "stale-anim")
+
+	ui.Frame = 4
+	AssertEq(NodeState[SliderState](live).Perc, .5, t)
+	ui.sweepState()
+
+	AssertEq(cleaned, true, t)
+	AssertEq(ui.Stats().Data, 1, t)
+	AssertEq(ui.Stats().Anim, 0, t)
+	AssertEq(ui.Stats().Swept, 2, t)
+}
+
+func TestNearestInDirection(t *testing.T) {
+	grid := make([]*Node, 4)
+	for i := range grid {
+		grid[i] = testNode("button", nil, Px(10), Px(10))
+		grid[i].Pos = V2{X: float32(i%2) * 20, Y: float32(i/2) * 20}
+		grid[i].RealSize = V2{X: 10, Y: 10}
+	}
+	// A wide node below the grid, that overlaps both columns
+	wide := testNode("button", nil, Px(30), Px(10))
+	wide.Pos = V2{X: 0, Y: 60}
+	wide.RealSize = V2{X: 30, Y: 10}
+	nodes := append(grid, wide)
+
+	AssertEq(nearestInDirection(grid[0], nodes, 1, 0), grid[1], t)
+	AssertEq(nearestInDirection(grid[0], nodes, 0, 1), grid[2], t)
+	AssertEq(nearestInDirection(grid[3], nodes, -1, 0), grid[2], t)
+	AssertEq(nearestInDirection(grid[3], nodes, 0, 1), wide, t)
+	AssertEq(nearestInDirection(wide, nodes, 0, -1), grid[2], t)
+	AssertEq(nearestInDirection(grid[1], nodes, 1, 0), nil, t)
+}
@@ -0,0 +1,358 @@
+package ui
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/glupi-borna/soko/internal/lru"
+	. "github.com/glupi-borna/soko/internal/platform"
+	"github.com/glupi-borna/soko/internal/system"
+	. "github.com/glupi-borna/soko/internal/utils"
+	"github.com/veandco/go-sdl2/sdl"
+	"github.com/veandco/go-sdl2/ttf"
+)
+
+// A piece of RichText. Empty fields are inherited from the node.
+type Span struct {
+	Text     string
+	Font     string
+	FontSize int
+	Bold, Italic, Underline bool
+	// Colors with zero alpha are ignored
+	Color sdl.Color
+	// Icon name, or path to an image, drawn instead of the text
+	Icon string
+}
+
+type richRun struct {
+	span   *Span
+	text   string
+	font   *Font
+	icon   string
+	x      float32
+	width  float32
+	ascent float32
+	height float32
+}
+
+type richLine struct {
+	runs          []richRun
+	width, ascent float32
+	height        float32
+}
+
+func (s *Span) font(base *Font) *Font {
+	name := base.Name
+	if s.Font != "" { name = s.Font }
+	size := base.Size
+	if s.FontSize > 0 { size = s.FontSize }
+
+	style := ttf.STYLE_NORMAL
+	if s.Bold { style |= ttf.STYLE_BOLD }
+	if s.Italic { style |= ttf.STYLE_ITALIC }
+	if s.Underline { style |= ttf.STYLE_UNDERLINE }
+
+	return GetStyledFont(name, size, style)
+}
+
+func (s *Span) iconPath() string {
+	if strings.HasPrefix(s.Icon, "/") || strings.HasPrefix(s.Icon, "file://") {
+		return s.Icon
+	}
+	return system.GetIconPath(s.Icon)
+}
+
+// Splits text into words, each followed by the spaces after it.
+// Newlines are returned as separate tokens.
+func richTokens(text string) []string {
+	tokens := make([]string, 0, 4)
+	start := 0
+	in_space := false
+
+	for i, r := range text {
+		switch {
+		case r == '\n':
+			if i > start { tokens = append(tokens, text[start:i]) }
+			tokens = append(tokens, "\n")
+			start = i + 1
+			in_space = false
+		case unicode.IsSpace(r):
+			in_space = true
+		case in_space:
+			tokens = append(tokens, text[start:i])
+			start = i
+			in_space = false
+		}
+	}
+
+	if start < len(text) { tokens = append(tokens, text[start:]) }
+	return tokens
+}
+
+// Lays the spans out in lines that are at most max_width wide
+// (no limit if 0). Lines only break between words.
+func (n *Node) layoutSpans(max_width float32) []richLine {
+	base := n.GetFont()
+	lines := make([]richLine, 0, 1)
+	line := richLine{}
+
+	finish := func() {
+		if len(line.runs) > 0 {
+			last := &line.runs[len(line.runs)-1]
+			if last.icon == "" {
+				last.text = strings.TrimRightFunc(last.text, unicode.IsSpace)
+				last.width = Platform.MeasureText(last.font, last.text).X
+			}
+			line.width = last.x + last.width
+		}
+
+		var descent float32 = 0
+		for _, run := range line.runs {
+			line.ascent = Max(line.ascent, run.ascent)
+			descent = Max(descent, run.height-run.ascent)
+		}
+		if len(line.runs) == 0 {
+			line.ascent = float32(base.SDLFont.Ascent())
+			descent = Platform.MeasureText(base, "").Y - line.ascent
+		}
+		line.height = line.ascent + descent
+
+		lines = append(lines, line)
+		line = richLine{}
+	}
+
+	// Adds a run to the line, merging it with the previous
+	// one if they share a span, so that it renders as one texture.
+	add := func(run richRun) {
+		if len(line.runs) > 0 {
+			last := &line.runs[len(line.runs)-1]
+			if run.icon == "" && last.icon == "" && last.span == run.span {
+				last.text += run.text
+				last.width = Platform.MeasureText(last.font, last.text).X
+				return
+			}
+			run.x = last.x + last.width
+		}
+		line.runs = append(line.runs, run)
+	}
+
+	fits := func(width float32) bool {
+		if max_width <= 0 || len(line.runs) == 0 { return true }
+		last := line.runs[len(line.runs)-1]
+		return last.x+last.width+width <= max_width
+	}
+
+	for i := range n.Spans {
+		span := &n.Spans[i]
+		font := span.font(base)
+
+		if span.Icon != "" {
+			size := font.Height
+			if !fits(size) { finish() }
+			add(richRun{span: span, icon: span.iconPath(), font: font, width: size, ascent: size, height: size})
+			continue
+		}
+
+		for _, token := range richTokens(span.Text) {
+			if token == "\n" {
+				finish()
+				continue
+			}
+
+			word := strings.TrimRightFunc(token, unicode.IsSpace)
+			if !fits(Platform.MeasureText(font, word).X) { finish() }
+
+			m := Platform.MeasureText(font, token)
+			add(richRun{
+				span:   span,
+				text:   token,
+				font:   font,
+				width:  m.X,
+				ascent: float32(font.SDLFont.Ascent()),
+				height: m.Y,
+			})
+		}
+	}
+
+	finish()
+	return lines
+}
+
+func richTextRenderFn(n *Node) {
+	s := n.GetStyle()
+	hov := CurrentUI.Active == n.UID || n.IsChildOfUID(CurrentUI.Active)
+	c := s.Foreground.Normal
+	if hov { c = s.Foreground.Active }
+
+	drawNodeRectBg(n.Pos, n.RealSize, s, hov)
+
+	if n.richLines == nil { n.layoutText() }
+	width := n.RealSize.X - n.Padding.xPadding()
+	y := n.Pos.Y + n.Padding.Top
+
+	for _, line := range n.richLines {
+		x := n.Pos.X + n.Padding.Left
+		switch n.TextAlign {
+		case A_CENTER:
+			x += (width - line.width) * .5
+		case A_END:
+			x += width - line.width
+		}
+
+		baseline := y + line.ascent
+		for _, run := range line.runs {
+			top := baseline - run.ascent
+			if run.icon != "" {
+				Platform.DrawImage(x+run.x, top, run.width, run.height, run.icon)
+				continue
+			}
+			if run.text == "" { continue }
+
+			if run.span.Color.A != 0 {
+				Platform.SetColor(run.span.Color)
+			} else {
+				Platform.SetColor(c)
+			}
+			Platform.RawSetFont(run.font)
+			Platform.DrawText(run.text, x+run.x, top)
+		}
+
+		y += line.height
+	}
+}
+
+// Text made of differently styled spans and inline icons,
+// which share a baseline and wrap at Size.MaxW.
+func RichText(spans ...Span) *Node {
+	n := CurrentUI.Push("rich_text")
+	defer CurrentUI.Pop(n)
+
+	n.Spans = spans
+	n.Size.W = FitText()
+	n.Size.H = FitText()
+	n.Padding = PaddingType{}
+
+	n.RenderFn = richTextRenderFn
+	return n
+}
+
+// RichText from markup, see ParseMarkup.
+func RichMarkup(markup string) *Node {
+	return RichText(ParseMarkup(markup)...)
+}
+
+var markupTagRe = regexp.MustCompile(`^<(/?)(\w+)((?:\s+\w+\s*=\s*(?:"[^"]*"|'[^']*'))*)\s*(/?)>`)
+var markupAttrRe = regexp.MustCompile(`(\w+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+var markupEntities = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&quot;", "\"", "&amp;", "&")
+
+var markupCache = lru.New(100, func([]Span) {})
+
+// Parses Pango-like markup into spans. Supported tags are <b>, <i>, <u>,
+// <span> (with color="#rrggbb[aa]", font, size, weight="bold",
+// style="italic" and underline="single" attributes) and <icon name=""/>.
+func ParseMarkup(markup string) []Span {
+	spans, ok := markupCache.Get(markup)
+	if !ok {
+		spans = parseMarkup(markup)
+		markupCache.Set(markup, spans)
+	}
+	return append([]Span(nil), spans...)
+}
+
+func parseMarkup(markup string) []Span {
+	spans := make([]Span, 0, 4)
+	stack := []Span{{}}
+	text := strings.Builder{}
+
+	flush := func() {
+		if text.Len() == 0 { return }
+		span := stack[len(stack)-1]
+		span.Text = markupEntities.Replace(text.String())
+		spans = append(spans, span)
+		text.Reset()
+	}
+
+	for len(markup) > 0 {
+		match := markupTagRe.FindStringSubmatch(markup)
+		if markup[0] != '<' || match == nil {
+			next := strings.IndexByte(markup[1:], '<')
+			if next == -1 { next = len(markup) - 1 }
+			text.WriteString(markup[:next+1])
+			markup = markup[next+1:]
+			continue
+		}
+		markup = markup[len(match[0]):]
+		flush()
+
+		closing, tag, self_closing := match[1] != "", match[2], match[4] != ""
+		if closing {
+			if len(stack) > 1 { stack = stack[:len(stack)-1] }
+			continue
+		}
+
+		span := stack[len(stack)-1]
+		attrs := map[string]string{}
+		for _, attr := range markupAttrRe.FindAllStringSubmatch(match[3], -1) {
+			attrs[attr[1]] = attr[2] + attr[3]
+		}
+
+		switch tag {
+		case "b":
+			span.Bold = true
+		case "i":
+			span.Italic = true
+		case "u":
+			span.Underline = true
+		case "span":
+			applyMarkupAttrs(&span, attrs)
+		case "icon":
+			span.Icon = attrs["name"]
+			span.Text = ""
+			spans = append(spans, span)
+			continue
+		default:
+			fmt.Println("ParseMarkup(): unknown tag:", tag)
+		}
+
+		if !self_closing { stack = append(stack, span) }
+	}
+
+	flush()
+	return spans
+}
+
+func applyMarkupAttrs(span *Span, attrs map[string]string) {
+	for key, val := range attrs {
+		switch key {
+		case "color", "foreground", "fgcolor":
+			hex := strings.TrimPrefix(val, "#")
+			col, err := strconv.ParseUint(hex, 16, 32)
+			if err != nil || (len(hex) != 6 && len(hex) != 8) {
+				fmt.Println("ParseMarkup(): invalid color:", val)
+				continue
+			}
+			if len(hex) == 6 { col = col<<8 | 0xff }
+			span.Color = ColHex(uint32(col))
+		case "font", "face":
+			span.Font = val
+		case "size":
+			size, err := strconv.Atoi(val)
+			if err != nil {
+				fmt.Println("ParseMarkup(): invalid size:", val)
+				continue
+			}
+			span.FontSize = size
+		case "weight":
+			span.Bold = val == "bold"
+		case "style":
+			span.Italic = val == "italic"
+		case "underline":
+			span.Underline = val != "none"
+		default:
+			fmt.Println("ParseMarkup(): unknown attribute:", key)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package ui
+
+import (
+	"testing"
+	. "github.com/glupi-borna/soko/tests"
+)
+
+func TestParseMarkup(t *testing.T) {
+	spans := ParseMarkup(`CPU <b>42%</b><span color="#ff0000" size="12"> &amp; <i>hot</i></span><icon name="cpu"/> a < b`)
+
+	AssertEq(len(spans), 6, t)
+	AssertEq(spans[0].Text, "CPU ", t)
+	AssertEq(spans[1].Text, "42%", t)
+	AssertEq(spans[1].Bold, true, t)
+	AssertEq(spans[2].Text, " & ", t)
+	AssertEq(spans[2].Color, ColHex(0xff0000ff), t)
+	AssertEq(spans[2].FontSize, 12, t)
+	AssertEq(spans[3].Italic, true, t)
+	AssertEq(spans[3].FontSize, 12, t)
+	AssertEq(spans[4].Icon, "cpu", t)
+	AssertEq(spans[5].Text, " a < b", t)
+	AssertEq(spans[5].Bold, false, t)
+
+	// Cached, but callers get their own copy
+	spans[0].Text = "GPU "
+	AssertEq(ParseMarkup(`CPU <b>42%</b><span color="#ff0000" size="12"> &amp; <i>hot</i></span><icon name="cpu"/> a < b`)[0].Text, "CPU ", t)
+}
+
+func TestRichTokens(t *testing.T) {
+	tokens := richTokens("  hello world\nfoo  bar ")
+
+	AssertEq(len(tokens), 6, t)
+	AssertEq(tokens[1], "hello ", t)
+	AssertEq(tokens[3], "\n", t)
+	AssertEq(tokens[4], "foo  ", t)
+}
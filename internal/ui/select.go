@@ -0,0 +1,208 @@
+package ui
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	. "github.com/glupi-borna/soko/internal/platform"
+	. "github.com/glupi-borna/soko/internal/utils"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// Number of options that are shown before the list scrolls
+const SELECT_VISIBLE_OPTIONS = 8
+
+// Time after which type-ahead starts a new search
+const TYPE_AHEAD_TIMEOUT = time.Second
+
+type SelectState struct {
+	Open bool
+	// Option that Enter selects while the list is open
+	Highlight int
+	// Text typed for type-ahead, and the time when it was last typed
+	search   string
+	lastType time.Duration
+	// Width of the select in the last frame, the list is at least as wide
+	width float32
+	// Option that the list was last scrolled to
+	shown int
+}
+
+// Appends text to the type-ahead search (or starts a new one), and
+// returns the index of the first option after the highlighted one that
+// starts with the search, or -1. Typing the same letter again cycles
+// through the options that start with it.
+func (s *SelectState) typeAhead(options []string, text string, now time.Duration) int {
+	if now-s.lastType > TYPE_AHEAD_TIMEOUT { s.search = "" }
+	s.lastType = now
+	s.search += strings.ToLower(text)
+
+	search, start := s.search, s.Highlight
+	first, _ := utf8.DecodeRuneInString(search)
+	if strings.Trim(search, string(first)) == "" {
+		search = string(first)
+		start++
+	}
+
+	for i := range options {
+		j := (start + i) % len(options)
+		if strings.HasPrefix(strings.ToLower(options[j]), search) { return j }
+	}
+	return -1
+}
+
+// Applies the keyboard input of this frame to the open list.
+// Returns the index of the option that was picked, or -1.
+func (s *SelectState) handleKeys(options []string) int {
+	last := len(options) - 1
+	switch {
+	case Platform.ComboPressed("Up"): s.Highlight--
+	case Platform.ComboPressed("Down"): s.Highlight++
+	case Platform.ComboPressed("PageUp"): s.Highlight -= SELECT_VISIBLE_OPTIONS
+	case Platform.ComboPressed("PageDown"): s.Highlight += SELECT_VISIBLE_OPTIONS
+	case Platform.ComboPressed("Home"): s.Highlight = 0
+	case Platform.ComboPressed("End"): s.Highlight = last
+	case Platform.ComboPressed("Return"), Platform.ComboPressed("Keypad Enter"), Platform.ComboPressed("Space"):
+		s.Open = false
+		return s.Highlight
+	default:
+		return -1
+	}
+	s.Highlight = Clamp(s.Highlight, 0, last)
+	CurrentUI.ConsumeNav()
+	return -1
+}
+
+func selectUpdateFn(n *Node) {
+	defaultUpdateFn(n)
+	NodeState[SelectState](n).width = n.RealSize.X
+}
+
+// Draws the select, with an arrow at its end.
+func selectRenderFn(n *Node) {
+	s := n.GetStyle()
+	hov := n.Focused() || n.HasFocus()
+	drawNodeRectBg(n.Pos, n.RealSize, s, hov)
+
+	var size float32 = 5
+	x := n.Pos.X + n.RealSize.X - n.Padding.Right + size
+	y := n.Pos.Y + (n.RealSize.Y-size)*.5
+	c := s.Foreground.Normal
+	if hov { c = s.Foreground.Active }
+	Platform.SetColor(c)
+	for i := float32(0); i < size; i++ {
+		Platform.DrawRectFilled(x+i, y+i, size*2-i*2, 1)
+	}
+}
+
+func selectOptionRenderFn(n *Node) {
+	drawTextNode(n, NodeState[CheckState](n).Checked)
+}
+
+// Shows the selected option, and opens a list of the options when it is
+// clicked. The list floats over the rest of the UI (growing the window if
+// it does not fit), and closes when an option is picked, or with Escape,
+// or a click outside of it. Returns the selected option, and whether the
+// user changed it in this frame.
+func Select(options []string, selected string) (string, *Node, bool) {
+	n := CurrentUI.Push("select")
+	defer CurrentUI.Pop(n)
+
+	n.Flags.Focusable = true
+	n.Layout = LT_HORIZONTAL
+	n.Style = &SelectStyle
+	n.Padding = PaddingType{Left: 8, Right: 24, Top: 4, Bottom: 4}
+	n.RenderFn = selectRenderFn
+	n.UpdateFn = selectUpdateFn
+	label := Text(selected)
+
+	state := NodeState[SelectState](n)
+	picked := -1
+	current := -1
+	for i, option := range options {
+		if option == selected { current = i }
+	}
+
+	if len(options) == 0 {
+		state.Open = false
+	} else if state.Open {
+		if n.HasFocus() { picked = state.handleKeys(options) }
+		closed := Platform.ComboPressed("Escape") || Platform.ComboPressed("Tab") || Platform.ComboPressed("Shift+Tab")
+		if closed || (picked == -1 && n.Clicked()) { state.Open = false }
+	} else if n.Clicked() {
+		state.Open = true
+		state.Highlight = Max(current, 0)
+		state.shown = -1
+	}
+
+	// Space opens and picks, so it is not part of the search
+	if n.HasFocus() && Platform.TextInput != "" && Platform.TextInput != " " {
+		i := state.typeAhead(options, Platform.TextInput, CurrentUI.FrameStart)
+		if i != -1 { state.Highlight = i }
+		if i != -1 && !state.Open { picked = i }
+	}
+
+	if state.Open { picked = Max(picked, selectList(n, state, options)) }
+
+	if picked == -1 || picked == current { return selected, n, false }
+	label.Text = options[picked]
+	return options[picked], n, true
+}
+
+// Builds the open list of a select. Returns the index
+// of the option that was clicked, or -1.
+func selectList(n *Node, state *SelectState, options []string) int {
+	f := n.GetFont()
+	opt_padding := Padding2(8, 2)
+	line_h := Platform.LineHeight(f)
+	width := state.width
+	for _, option := range options {
+		width = Max(width, Platform.MeasureText(f, option).X+opt_padding.xPadding()+SCROLLBAR_WIDTH)
+	}
+
+	list := Float(n.UID)
+	defer CurrentUI.Pop(list)
+	list.Anchor = V2{Y: 1}
+	list.Offset = V2{Y: 2}
+	list.Padding = Padding1(0)
+	list.Style = &SelectStyle
+
+	scroller := ScrollBegin()
+	defer ScrollEnd()
+	scroller.Window.Size.W = Px(width)
+	visible := float32(Min(len(options), SELECT_VISIBLE_OPTIONS))
+	scroller.Window.Size.H = Px((line_h + opt_padding.yPadding()) * visible)
+	scroller.Window.Padding = Padding1(0)
+	scroller.State().Scrollbars = true
+	scroller.View.Layout = LT_VERTICAL
+	scroller.View.Padding = Padding1(0)
+
+	picked := -1
+	for i, option := range options {
+		opt := Text(option)
+		opt.Padding = opt_padding
+		opt.Size.W = Px(width - opt_padding.xPadding() - SCROLLBAR_WIDTH)
+		opt.Size.H = Px(line_h)
+		opt.RenderFn = selectOptionRenderFn
+
+		if opt.HasMouse() && Platform.MouseDelta.ManhattanLength() > 0 {
+			state.Highlight = i
+		}
+		if opt.HasMouse() && Platform.MouseReleased(sdl.BUTTON_LEFT) { picked = i }
+		NodeState[CheckState](opt).Checked = i == state.Highlight
+		if i == state.Highlight && i != state.shown {
+			scroller.ScrollTo(opt)
+			state.shown = i
+		}
+	}
+
+	if Platform.MousePressed(sdl.BUTTON_LEFT) && !n.HasMouse() && !list.HasMouse() {
+		state.Open = false
+	}
+	if picked != -1 {
+		state.Open = false
+		CurrentUI.SetFocus(n)
+	}
+	return picked
+}
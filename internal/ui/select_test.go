@@ -0,0 +1,25 @@
+package ui
+
+import (
+	"testing"
+	"time"
+	. "github.com/glupi-borna/soko/tests"
+)
+
+func TestTypeAhead(t *testing.T) {
+	options := []string{"Speakers", "HDMI", "Headphones", "hdmi 2"}
+	s := SelectState{}
+
+	AssertEq(s.typeAhead(options, "h", time.Second), 1, t)
+	AssertEq(s.typeAhead(options, "e", time.Second), 2, t)
+
+	// Repeating a letter cycles through the options that start with it
+	s = SelectState{Highlight: 1}
+	AssertEq(s.typeAhead(options, "h", time.Second), 2, t)
+	s.Highlight = 2
+	AssertEq(s.typeAhead(options, "h", time.Second), 3, t)
+
+	// The search starts over after a pause
+	AssertEq(s.typeAhead(options, "s", 3*time.Second), 0, t)
+	AssertEq(s.typeAhead(options, "x", 3*time.Second), -1, t)
+}
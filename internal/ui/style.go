@@ -11,6 +11,19 @@ const (
 	A_START ALIGN = iota
 	A_CENTER
 	A_END
+	A_AUTO // Inherit the alignment (see Node.AlignSelf)
+)
+
+// Positioning of children along the layout direction
+type JUSTIFY int
+
+const (
+	J_START JUSTIFY = iota
+	J_CENTER
+	J_END
+	J_SPACE_BETWEEN
+	J_SPACE_AROUND
+	J_SPACE_EVENLY
 )
 
 type StyleVariant[K any] struct {
@@ -78,6 +91,27 @@ func Padding(args ...float32) PaddingType {
 	return PaddingType{}
 }
 
+// Space between the children of a node. Row is the space between rows
+// (vertical), and Column is the space between columns (horizontal).
+type GapType struct {
+	Row, Column float32
+}
+
+func Gap1(gap float32) GapType {
+	return GapType{gap, gap}
+}
+
+func Gap2(row float32, column float32) GapType {
+	return GapType{row, column}
+}
+
+func Gap(args ...float32) GapType {
+	if len(args) == 1 { return Gap1(args[0]) }
+	if len(args) == 2 { return Gap2(args[0], args[1]) }
+	fmt.Println("Gap(): unsupported number of arguments:", len(args))
+	return GapType{}
+}
+
 type Style struct {
 	Foreground   StyleVariant[sdl.Color]
 	Background   StyleVariant[sdl.Color]
@@ -87,6 +121,8 @@ type Style struct {
 	Align        ALIGN
 	Font         string
 	FontSize     int
+	// Outline of the focused node, inherited if the alpha is 0
+	FocusRing sdl.Color
 }
 
 func (s *Style) Copy() *Style {
@@ -112,6 +148,7 @@ var DefaultStyle = Style{
 	Border: StyleVar(ColHex(0x0)),
 	Font: "Sans",
 	FontSize: 16,
+	FocusRing: ColHex(0x8be9fdff),
 }
 
 var ButtonStyle = Style{
@@ -120,6 +157,60 @@ var ButtonStyle = Style{
 	CornerRadius: StyleVar[float32](5),
 }
 
+var TextInputStyle = Style{
+	Foreground: StyleVar(Col(0)),
+	Background: StyleVar2(Col(255), Col(240)),
+	Border: StyleVar2(Col(160), ColHex(0x8be9fdff)),
+	CornerRadius: StyleVar[float32](4),
+}
+
+// Also used for the list of options, where Background.Active
+// is the background of the highlighted option
+var SelectStyle = Style{
+	Foreground: StyleVar(Col(0)),
+	Background: StyleVar2(Col(255), Col(225)),
+	Border: StyleVar2(Col(160), ColHex(0x8be9fdff)),
+	CornerRadius: StyleVar[float32](4),
+}
+
+// Background of context menus and submenus
+var MenuStyle = Style{
+	Foreground: StyleVar(Col(0)),
+	Background: StyleVar(Col(255)),
+	Border: StyleVar(Col(160)),
+	CornerRadius: StyleVar[float32](4),
+}
+
+// Background.Active is the background of the highlighted item
+var MenuItemStyle = Style{
+	Foreground: StyleVar(Col(0)),
+	Background: StyleVar2(ColHex(0x0), Col(225)),
+	CornerRadius: StyleVar[float32](3),
+}
+
+var MenuDisabledItemStyle = Style{
+	Foreground: StyleVar(Col(150)),
+	Background: StyleVar(ColHex(0x0)),
+}
+
+var CheckboxStyle = Style{
+	Foreground: StyleVar(Col(0)),
+	Background: StyleVar2(Col(255), Col(220)),
+	Border: StyleVar(Col(160)),
+	CornerRadius: StyleVar[float32](3),
+}
+
+// Radio buttons are always round, so CornerRadius is ignored
+var RadioStyle = CheckboxStyle
+
+// Background is the track while the toggle is off, and
+// Foreground is the knob. The track takes the FocusRing
+// color while the toggle is on.
+var ToggleStyle = Style{
+	Foreground: StyleVar(Col(255)),
+	Background: StyleVar2(Col(110), Col(130)),
+}
+
 var SliderStyle = ButtonStyle.Copy().
 	Invert().
 	SetBorder(
@@ -0,0 +1,302 @@
+package ui
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	. "github.com/glupi-borna/soko/internal/platform"
+	. "github.com/glupi-borna/soko/internal/utils"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+type TextAreaState struct {
+	TextInputState
+	// Vertical scrolling, which works like in scroll windows
+	Scroller ScrollerState
+	// Visual lines of the value, wrapped to wrapWidth
+	lines     []TextLine
+	wrapValue string
+	wrapWidth float32
+	// Horizontal position that Up/Down keep the cursor at
+	goalX   float32
+	hasGoal bool
+	// Cursor that was last scrolled into view
+	shownCursor int
+	// The end of a line that was broken between letters is also the
+	// start of the next line. Set when the cursor was put at the end,
+	// so that it is drawn and moved there instead.
+	endAffinity bool
+}
+
+// Returns the line and column of the cursor, counted from 1. Lines
+// are separated by newlines, so a wrapped line counts as one line.
+func (s *TextAreaState) LineColumn() (int, int) {
+	before := s.Value[:s.Cursor]
+	line_start := strings.LastIndexByte(before, '\n') + 1
+	return strings.Count(before, "\n") + 1, utf8.RuneCountInString(before[line_start:]) + 1
+}
+
+// Returns the number of lines, as counted by LineColumn.
+func (s *TextAreaState) LineCount() int {
+	return strings.Count(s.Value, "\n") + 1
+}
+
+// Returns the index of the visual line that the offset is on.
+func lineAt(lines []TextLine, offset int) int {
+	i := sort.Search(len(lines), func(i int) bool { return lines[i].Start > offset })
+	return Max(i-1, 0)
+}
+
+// Returns the index of the visual line that the cursor is on.
+func (s *TextAreaState) cursorLine() int {
+	i := lineAt(s.lines, s.Cursor)
+	if s.endAffinity && i > 0 && s.lines[i-1].End == s.Cursor { return i - 1 }
+	return i
+}
+
+// Moves the cursor to the offset in the visual line index.
+func (s *TextAreaState) placeCursor(index, offset int, extend bool) {
+	s.moveTo(offset, extend)
+	s.endAffinity = index+1 < len(s.lines) && s.lines[index].End == offset && s.lines[index+1].Start == offset
+}
+
+// Wraps the value again, if it or the width changed since the last
+// wrap. Returns true if it did.
+func (s *TextAreaState) wrap(f *Font, width float32) bool {
+	if s.lines != nil && s.wrapValue == s.Value && s.wrapWidth == width { return false }
+	s.lines = Platform.WrapTextOffsets(f, s.Value, width)
+	s.wrapValue, s.wrapWidth = s.Value, width
+	return true
+}
+
+// Returns the x position of the offset, relative
+// to the start of the visual line index.
+func (s *TextAreaState) xAt(f *Font, index, offset int) float32 {
+	line := s.lines[index]
+	return Platform.MeasureWidth(f, s.Value[line.Start:Clamp(offset, line.Start, line.End)])
+}
+
+// Returns the offset in the visual line that is closest to x.
+func (s *TextAreaState) offsetInLine(f *Font, index int, x float32) int {
+	line := s.lines[index]
+	best, best_dist := line.Start, Abs(x)
+	for i := line.Start; i < line.End; {
+		i = nextRune(s.Value, i)
+		dist := Abs(Platform.MeasureWidth(f, s.Value[line.Start:i]) - x)
+		if dist < best_dist { best, best_dist = i, dist }
+	}
+	return best
+}
+
+// Moves the cursor by count visual lines, keeping its horizontal position.
+func (s *TextAreaState) moveLines(f *Font, count int, extend bool) {
+	line := s.cursorLine()
+	if !s.hasGoal { s.goalX, s.hasGoal = s.xAt(f, line, s.Cursor), true }
+	target := line + count
+	switch {
+	case target < 0: s.placeCursor(0, 0, extend)
+	case target >= len(s.lines): s.placeCursor(len(s.lines)-1, len(s.Value), extend)
+	default: s.placeCursor(target, s.offsetInLine(f, target, s.goalX), extend)
+	}
+}
+
+// Handles the keys that work differently in a text area, and passes the
+// rest to the text input. Enter inserts a new line, and Ctrl+Enter submits.
+func (s *TextAreaState) handleKeys(f *Font, page int) (changed, submitted bool) {
+	if Platform.TextComposition != "" || s.lines == nil { return s.TextInputState.handleKeys() }
+
+	mods := Platform.KeyMods()
+	extend := mods&KM_SHIFT != 0
+	ctrl := mods&KM_CTRL != 0
+	key := func(sc sdl.Scancode) bool { return Platform.KeyboardPressed(uint32(sc)) }
+	index := s.cursorLine()
+	line := s.lines[index]
+
+	switch {
+	case key(sdl.SCANCODE_UP): s.moveLines(f, -1, extend)
+	case key(sdl.SCANCODE_DOWN): s.moveLines(f, 1, extend)
+	case key(sdl.SCANCODE_PAGEUP): s.moveLines(f, -page, extend)
+	case key(sdl.SCANCODE_PAGEDOWN): s.moveLines(f, page, extend)
+	case key(sdl.SCANCODE_HOME) && !ctrl:
+		s.placeCursor(index, line.Start, extend)
+		s.hasGoal = false
+	case key(sdl.SCANCODE_END) && !ctrl:
+		s.placeCursor(index, line.End, extend)
+		s.hasGoal = false
+	case (key(sdl.SCANCODE_RETURN) || key(sdl.SCANCODE_KP_ENTER)) && !ctrl:
+		old := s.Value
+		s.typeText(Platform.TextInput+"\n", false)
+		s.hasGoal = false
+		s.endAffinity = false
+		s.lastEdit = CurrentUI.FrameStart
+		return s.Value != old, false
+	default:
+		if Platform.AnyKeyPressed || Platform.TextInput != "" { s.hasGoal, s.endAffinity = false, false }
+		return s.TextInputState.handleKeys()
+	}
+
+	CurrentUI.ConsumeNav()
+	s.typing = false
+	s.lastEdit = CurrentUI.FrameStart
+	return false, false
+}
+
+func textAreaUpdateFn(n *Node) {
+	state := NodeState[TextAreaState](n)
+	scroll := &state.Scroller
+	f := n.GetFont()
+	line_h := Platform.LineHeight(f)
+
+	scroll.ViewSize.X = n.RealSize.X - n.Padding.xPadding()
+	scroll.ViewSize.Y = n.RealSize.Y - n.Padding.yPadding()
+	// The text is wrapped next to the scrollbar, so that it never covers it
+	rewrapped := state.wrap(f, scroll.ViewSize.X-SCROLLBAR_WIDTH-2)
+	scroll.MaxOffset = V2{Y: Max(float32(len(state.lines))*line_h-scroll.ViewSize.Y, 0)}
+	last_target := scroll.TargetOffset
+
+	text_x := n.Pos.X + n.Padding.Left
+	text_y := n.Pos.Y + n.Padding.Top + scroll.Offset.Y
+	mouse := Platform.MousePos
+	placeAtMouse := func(extend bool) {
+		line := Clamp(int((mouse.Y-text_y)/line_h), 0, len(state.lines)-1)
+		state.placeCursor(line, state.offsetInLine(f, line, mouse.X-text_x), extend)
+	}
+
+	// Dragging selects text
+	if n.UID == n.UI.Hot && scroll.Drag == SD_NONE {
+		placeAtMouse(true)
+		if Platform.MouseReleased(sdl.BUTTON_LEFT) { CurrentUI.SetHot(nil, false) }
+	}
+
+	// The wheel and the scrollbar work like in scroll windows
+	scrollWindowMouse(n, scroll)
+
+	if CurrentUI.Mode == IM_MOUSE && n.HasMouse() && scroll.Drag == SD_NONE {
+		CurrentUI.SetActive(n, false)
+		if Platform.MousePressed(sdl.BUTTON_LEFT) {
+			CurrentUI.SetHot(n, false)
+			CurrentUI.SetFocus(n)
+			placeAtMouse(Platform.KeyMods()&KM_SHIFT != 0)
+			state.typing = false
+			state.hasGoal = false
+			state.lastEdit = CurrentUI.FrameStart
+		}
+	}
+
+	// Scroll to the cursor when it moves, but not while the
+	// wheel or the scrollbar are used to look around
+	line := state.cursorLine()
+	if n.HasFocus() && (rewrapped || state.Cursor != state.shownCursor) {
+		scroll.revealRect(0, float32(line)*line_h, 0, line_h)
+		state.shownCursor = state.Cursor
+	}
+	scroll.settle(n, last_target)
+
+	if !n.HasFocus() { return }
+	x := text_x + state.xAt(f, line, state.Cursor)
+	y := n.Pos.Y + n.Padding.Top + scroll.Offset.Y + float32(line)*line_h
+	Platform.SetTextInputRect(x, y, 1, line_h)
+}
+
+func textAreaRenderFn(n *Node) {
+	state := NodeState[TextAreaState](n)
+	s := n.GetStyle()
+	f := n.GetFont()
+	focused := n.HasFocus()
+	drawNodeRectBg(n.Pos, n.RealSize, s, focused || CurrentUI.Active == n.UID)
+	if state.lines == nil { return }
+
+	restore_clip := clipToContent(n)
+	line_h := Platform.LineHeight(f)
+	x := n.Pos.X + n.Padding.Left
+	y := n.Pos.Y + n.Padding.Top + state.Scroller.Offset.Y
+	fg := s.Foreground.Normal
+	Platform.RawSetFont(f)
+
+	composition := ""
+	if focused { composition = Platform.TextComposition }
+
+	if state.Value == "" && composition == "" && state.Options.Placeholder != "" {
+		c := fg
+		c.A /= 2
+		Platform.SetColor(c)
+		Platform.DrawText(state.Options.Placeholder, x, y)
+	}
+
+	// Only the visible lines are drawn, each on its own, so that
+	// their textures stay cached while other lines are edited
+	first := Max(int(-state.Scroller.Offset.Y/line_h), 0)
+	last := Min(first+int(state.Scroller.ViewSize.Y/line_h)+2, len(state.lines))
+	cursor_line := state.cursorLine()
+	sel_start, sel_end := state.selection()
+	sel_color := n.focusRingColor()
+	sel_color.A = 96
+
+	for i := first; i < last; i++ {
+		line := state.lines[i]
+		line_y := y + float32(i)*line_h
+		text := state.Value[line.Start:line.End]
+
+		if focused && state.hasSelection() && sel_start <= line.End && sel_end >= line.Start {
+			x1 := Platform.MeasureWidth(f, state.Value[line.Start:Clamp(sel_start, line.Start, line.End)])
+			x2 := Platform.MeasureWidth(f, state.Value[line.Start:Clamp(sel_end, line.Start, line.End)])
+			// The end of a selected line is marked, so that selected empty lines show up
+			if sel_end > line.End { x2 += f.Height / 3 }
+			Platform.SetColor(sel_color)
+			Platform.DrawRectFilled(x+x1, line_y, x2-x1, f.Height)
+		}
+
+		Platform.SetColor(fg)
+		if i == cursor_line && composition != "" {
+			before := state.Value[line.Start:state.Cursor]
+			before_w := Platform.MeasureWidth(f, before)
+			text = before + composition + state.Value[state.Cursor:line.End]
+			Platform.DrawRectFilled(x+before_w, line_y+f.Height-1, Platform.MeasureWidth(f, composition), 1)
+		}
+		if text != "" { Platform.DrawText(text, x, line_y) }
+	}
+
+	blink := (CurrentUI.FrameStart-state.lastEdit)/CURSOR_BLINK%2 == 0
+	if focused && blink {
+		runes := []rune(composition)
+		composed := string(runes[:Clamp(Platform.TextCompositionCursor, 0, len(runes))])
+		cursor_x := x + state.xAt(f, cursor_line, state.Cursor) + Platform.MeasureWidth(f, composed)
+		Platform.SetColor(fg)
+		Platform.DrawRectFilled(cursor_x, y+float32(cursor_line)*line_h, 1, f.Height)
+	}
+
+	restore_clip()
+	drawScrollbars(n, &state.Scroller)
+}
+
+// A multi-line text input, which wraps its text and scrolls vertically.
+// Enter inserts a new line. Returns the new value, whether it changed
+// in this frame, and whether Ctrl+Enter was pressed. The Password
+// option is ignored.
+func TextArea(value string, opts ...TextInputOptions) (string, *Node, bool, bool) {
+	n := CurrentUI.Push("text_area")
+	defer CurrentUI.Pop(n)
+
+	n.Flags.Focusable = true
+	n.Flags.TextInput = true
+	n.Style = &TextInputStyle
+	n.Padding = Padding2(6, 4)
+	n.Size.W = Em(20)
+	n.Size.H = Em(8)
+	n.RenderFn = textAreaRenderFn
+	n.UpdateFn = textAreaUpdateFn
+
+	state := NodeState[TextAreaState](n)
+	state.Options = TextInputOptions{}
+	if len(opts) > 0 { state.Options = opts[0] }
+	state.Options.Password = false
+	state.multiline = true
+	state.Scroller.Scrollbars = true
+	if state.Value != value { state.reset(value) }
+
+	if !n.HasFocus() { return value, n, false, false }
+	page := Max(int(state.Scroller.ViewSize.Y/Platform.LineHeight(n.GetFont()))-1, 1)
+	changed, submitted := state.handleKeys(n.GetFont(), page)
+	return state.Value, n, changed, submitted
+}
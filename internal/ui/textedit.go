@@ -0,0 +1,141 @@
+package ui
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	. "github.com/glupi-borna/soko/internal/utils"
+)
+
+// Number of edits that can be undone
+const UNDO_LIMIT = 100
+
+// Text with a cursor and a selection. Offsets are in
+// bytes, and always lie on rune boundaries.
+type textEdit struct {
+	Value string
+	// The selection spans from Anchor to Cursor
+	Cursor, Anchor int
+}
+
+// Returns the start and end of the selection.
+func (e *textEdit) selection() (int, int) {
+	return Min(e.Cursor, e.Anchor), Max(e.Cursor, e.Anchor)
+}
+
+func (e *textEdit) hasSelection() bool { return e.Cursor != e.Anchor }
+
+func (e *textEdit) selected() string {
+	start, end := e.selection()
+	return e.Value[start:end]
+}
+
+// Moves the cursor to offset. If extend is true, the
+// selection is extended, otherwise it is cleared.
+func (e *textEdit) moveTo(offset int, extend bool) {
+	e.Cursor = Clamp(offset, 0, len(e.Value))
+	if !extend { e.Anchor = e.Cursor }
+}
+
+// Replaces the selection with text.
+func (e *textEdit) insert(text string) {
+	start, end := e.selection()
+	e.Value = e.Value[:start] + text + e.Value[end:]
+	e.moveTo(start+len(text), false)
+}
+
+// Deletes the selection, or the text between
+// the cursor and offset if nothing is selected.
+func (e *textEdit) deleteTo(offset int) {
+	if !e.hasSelection() { e.Anchor = Clamp(offset, 0, len(e.Value)) }
+	e.insert("")
+}
+
+// Returns the offset of the rune before i.
+func prevRune(s string, i int) int {
+	if i <= 0 { return 0 }
+	_, size := utf8.DecodeLastRuneInString(s[:i])
+	return i - size
+}
+
+// Returns the offset of the rune after i.
+func nextRune(s string, i int) int {
+	if i >= len(s) { return len(s) }
+	_, size := utf8.DecodeRuneInString(s[i:])
+	return i + size
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// Returns the start of the word before i.
+func prevWord(s string, i int) int {
+	word := false
+	for i > 0 {
+		r, size := utf8.DecodeLastRuneInString(s[:i])
+		if word && !isWordRune(r) { break }
+		word = word || isWordRune(r)
+		i -= size
+	}
+	return i
+}
+
+// Returns the end of the word after i.
+func nextWord(s string, i int) int {
+	word := false
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if word && !isWordRune(r) { break }
+		word = word || isWordRune(r)
+		i += size
+	}
+	return i
+}
+
+// A textEdit with undo history.
+type editHistory struct {
+	textEdit
+	undo, redo []textEdit
+	// The last change was typing. Typing is undone
+	// in one step, until something else happens.
+	typing bool
+}
+
+// Saves the current state for undo. Called before every change.
+func (h *editHistory) save(typing bool) {
+	if !typing || !h.typing {
+		h.undo = append(h.undo, h.textEdit)
+		if len(h.undo) > UNDO_LIMIT { h.undo = h.undo[1:] }
+	}
+	h.redo = h.redo[:0]
+	h.typing = typing
+}
+
+func (h *editHistory) undoEdit() bool {
+	if len(h.undo) == 0 { return false }
+	h.redo = append(h.redo, h.textEdit)
+	h.textEdit = h.undo[len(h.undo)-1]
+	h.undo = h.undo[:len(h.undo)-1]
+	h.typing = false
+	return true
+}
+
+func (h *editHistory) redoEdit() bool {
+	if len(h.redo) == 0 { return false }
+	h.undo = append(h.undo, h.textEdit)
+	h.textEdit = h.redo[len(h.redo)-1]
+	h.redo = h.redo[:len(h.redo)-1]
+	h.typing = false
+	return true
+}
+
+// Replaces the value (e.g. when it was changed outside of
+// the text input), which clears the undo history.
+func (h *editHistory) reset(value string) {
+	h.Value = value
+	h.moveTo(len(value), false)
+	h.undo = h.undo[:0]
+	h.redo = h.redo[:0]
+	h.typing = false
+}
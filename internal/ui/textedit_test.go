@@ -0,0 +1,105 @@
+package ui
+
+import (
+	"testing"
+	. "github.com/glupi-borna/soko/internal/platform"
+	. "github.com/glupi-borna/soko/tests"
+)
+
+func TestWordMovement(t *testing.T) {
+	s := "hello, wörld  foo_bar"
+
+	AssertEq(nextWord(s, 0), 5, t)
+	AssertEq(nextWord(s, 5), 13, t)
+	AssertEq(nextWord(s, 13), len(s), t)
+	AssertEq(prevWord(s, len(s)), 15, t)
+	AssertEq(prevWord(s, 15), 7, t)
+	AssertEq(prevWord(s, 7), 0, t)
+	AssertEq(prevRune(s, 10), 8, t)
+	AssertEq(nextRune(s, 8), 10, t)
+}
+
+func TestTextEdit(t *testing.T) {
+	e := textEdit{Value: "hello world"}
+	e.moveTo(6, false)
+	e.moveTo(11, true)
+	AssertEq(e.selected(), "world", t)
+
+	e.insert("there")
+	AssertEq(e.Value, "hello there", t)
+	AssertEq(e.Cursor, 11, t)
+	AssertEq(e.hasSelection(), false, t)
+
+	e.deleteTo(prevWord(e.Value, e.Cursor))
+	AssertEq(e.Value, "hello ", t)
+	AssertEq(e.Cursor, 6, t)
+}
+
+func TestEditHistory(t *testing.T) {
+	h := editHistory{}
+	for _, r := range "abc" {
+		h.save(true)
+		h.insert(string(r))
+	}
+	h.save(false)
+	h.deleteTo(prevRune(h.Value, h.Cursor))
+	AssertEq(h.Value, "ab", t)
+
+	h.undoEdit()
+	AssertEq(h.Value, "abc", t)
+	// Typing is undone in one step
+	h.undoEdit()
+	AssertEq(h.Value, "", t)
+	AssertEq(h.undoEdit(), false, t)
+
+	h.redoEdit()
+	AssertEq(h.Value, "abc", t)
+	AssertEq(h.Cursor, 3, t)
+}
+
+func TestLineColumn(t *testing.T) {
+	s := TextAreaState{}
+	s.Value = "first\nsecönd line\n"
+	// "secönd line" wrapped after "secönd"
+	lines := []TextLine{{0, 5}, {6, 13}, {14, 18}, {19, 19}}
+
+	AssertEq(lineAt(lines, 0), 0, t)
+	AssertEq(lineAt(lines, 5), 0, t)
+	AssertEq(lineAt(lines, 13), 1, t)
+	AssertEq(lineAt(lines, 14), 2, t)
+	AssertEq(lineAt(lines, 19), 3, t)
+
+	s.moveTo(14, false)
+	line, col := s.LineColumn()
+	AssertEq(line, 2, t)
+	AssertEq(col, 8, t)
+
+	s.moveTo(len(s.Value), false)
+	line, col = s.LineColumn()
+	AssertEq(line, 3, t)
+	AssertEq(col, 1, t)
+	AssertEq(s.LineCount(), 3, t)
+}
+
+func TestEndAffinity(t *testing.T) {
+	s := TextAreaState{}
+	s.Value = "abcdefgh ij"
+	// "abcdefgh" broken between letters, and wrapped before "ij"
+	s.lines = []TextLine{{0, 4}, {4, 8}, {9, 11}}
+
+	// The end of a broken line stays on it
+	s.placeCursor(0, 4, false)
+	AssertEq(s.cursorLine(), 0, t)
+	s.placeCursor(1, 4, false)
+	AssertEq(s.cursorLine(), 1, t)
+
+	// Lines wrapped at a space do not share offsets
+	s.placeCursor(1, 8, false)
+	AssertEq(s.endAffinity, false, t)
+	AssertEq(s.cursorLine(), 1, t)
+
+	// The affinity only applies at the end of the line
+	s.placeCursor(0, 4, false)
+	s.moveTo(5, false)
+	AssertEq(s.cursorLine(), 1, t)
+}
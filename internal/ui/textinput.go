@@ -0,0 +1,295 @@
+package ui
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	. "github.com/glupi-borna/soko/internal/platform"
+	. "github.com/glupi-borna/soko/internal/utils"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// Drawn instead of each character of a password
+const PASSWORD_MASK = "•"
+
+// Time for which the cursor is shown, and then hidden, while it blinks
+const CURSOR_BLINK = 500 * time.Millisecond
+
+type TextInputOptions struct {
+	// Shown while the input is empty
+	Placeholder string
+	// Hide the text behind PASSWORD_MASK
+	Password bool
+	// Maximum number of characters (0 for no limit)
+	MaxLength int
+}
+
+type TextInputState struct {
+	editHistory
+	Options TextInputOptions
+	// Horizontal offset of the text, which keeps the cursor visible
+	Scroll float32
+	// Time of the last key press, the cursor does not blink right after it
+	lastEdit time.Duration
+	// New lines are kept when typing and pasting
+	multiline bool
+}
+
+// Returns the text up to offset, as it is drawn.
+func (s *TextInputState) display(offset int) string {
+	if !s.Options.Password { return s.Value[:offset] }
+	return strings.Repeat(PASSWORD_MASK, utf8.RuneCountInString(s.Value[:offset]))
+}
+
+// Words are hidden in passwords, so word movement skips to the ends.
+func (s *TextInputState) prevWord() int {
+	if s.Options.Password { return 0 }
+	return prevWord(s.Value, s.Cursor)
+}
+
+func (s *TextInputState) nextWord() int {
+	if s.Options.Password { return len(s.Value) }
+	return nextWord(s.Value, s.Cursor)
+}
+
+// Inserts typed or pasted text, cut to fit into MaxLength.
+func (s *TextInputState) typeText(text string, typing bool) {
+	if s.multiline {
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+	} else {
+		text = strings.NewReplacer("\r\n", " ", "\n", " ").Replace(text)
+	}
+
+	if s.Options.MaxLength > 0 {
+		free := s.Options.MaxLength - utf8.RuneCountInString(s.Value) + utf8.RuneCountInString(s.selected())
+		runes := []rune(text)
+		if len(runes) > free { text = string(runes[:Max(free, 0)]) }
+	}
+
+	if text == "" { return }
+	s.save(typing)
+	s.insert(text)
+}
+
+// Returns the offset of the character boundary
+// closest to x, which is relative to the text.
+func (s *TextInputState) offsetAt(f *Font, x float32) int {
+	best, best_dist := 0, Abs(x)
+	for i := 0; i < len(s.Value); {
+		i = nextRune(s.Value, i)
+		dist := Abs(Platform.MeasureWidth(f, s.display(i)) - x)
+		if dist < best_dist { best, best_dist = i, dist }
+	}
+	return best
+}
+
+// Applies the keyboard input of this frame. Returns whether
+// the value changed, and whether Enter was pressed.
+func (s *TextInputState) handleKeys() (changed, submitted bool) {
+	// Keys belong to the input method while it composes text
+	if Platform.TextComposition != "" { return false, false }
+
+	old := s.Value
+	mods := Platform.KeyMods()
+	extend := mods&KM_SHIFT != 0
+	word := mods&KM_CTRL != 0
+	key := func(sc sdl.Scancode) bool { return Platform.KeyboardPressed(uint32(sc)) }
+
+	if Platform.TextInput != "" { s.typeText(Platform.TextInput, true) }
+
+	switch {
+	case key(sdl.SCANCODE_LEFT):
+		start, _ := s.selection()
+		switch {
+		case s.hasSelection() && !extend: s.moveTo(start, false)
+		case word: s.moveTo(s.prevWord(), extend)
+		default: s.moveTo(prevRune(s.Value, s.Cursor), extend)
+		}
+		CurrentUI.ConsumeNav()
+	case key(sdl.SCANCODE_RIGHT):
+		_, end := s.selection()
+		switch {
+		case s.hasSelection() && !extend: s.moveTo(end, false)
+		case word: s.moveTo(s.nextWord(), extend)
+		default: s.moveTo(nextRune(s.Value, s.Cursor), extend)
+		}
+		CurrentUI.ConsumeNav()
+	case key(sdl.SCANCODE_HOME):
+		s.moveTo(0, extend)
+	case key(sdl.SCANCODE_END):
+		s.moveTo(len(s.Value), extend)
+	case key(sdl.SCANCODE_BACKSPACE):
+		if !s.hasSelection() && s.Cursor == 0 { break }
+		s.save(false)
+		if word {
+			s.deleteTo(s.prevWord())
+		} else {
+			s.deleteTo(prevRune(s.Value, s.Cursor))
+		}
+	case key(sdl.SCANCODE_DELETE):
+		if !s.hasSelection() && s.Cursor == len(s.Value) { break }
+		s.save(false)
+		if word {
+			s.deleteTo(s.nextWord())
+		} else {
+			s.deleteTo(nextRune(s.Value, s.Cursor))
+		}
+	case key(sdl.SCANCODE_RETURN), key(sdl.SCANCODE_KP_ENTER):
+		submitted = true
+	case Platform.ComboPressed("Ctrl+A"):
+		s.Anchor, s.Cursor = 0, len(s.Value)
+	case Platform.ComboPressed("Ctrl+C"), Platform.ComboPressed("Ctrl+X"):
+		if !s.hasSelection() || s.Options.Password { break }
+		Platform.SetClipboard(s.selected())
+		if key(sdl.SCANCODE_X) {
+			s.save(false)
+			s.insert("")
+		}
+	case Platform.ComboPressed("Ctrl+V"):
+		s.typeText(Platform.Clipboard(), false)
+	case Platform.ComboPressed("Ctrl+Z"):
+		s.undoEdit()
+	case Platform.ComboPressed("Ctrl+Shift+Z"), Platform.ComboPressed("Ctrl+Y"):
+		s.redoEdit()
+	}
+
+	if Platform.AnyKeyPressed || Platform.TextInput != "" { s.lastEdit = CurrentUI.FrameStart }
+	// Moving the cursor ends the current typing undo step
+	if Platform.AnyKeyPressed && s.Value == old { s.typing = false }
+	return s.Value != old, submitted
+}
+
+func textInputUpdateFn(n *Node) {
+	state := NodeState[TextInputState](n)
+	f := n.GetFont()
+	text_x := n.Pos.X + n.Padding.Left - state.Scroll
+	mouse := Platform.MousePos
+
+	// Dragging selects text
+	if n.UID == n.UI.Hot {
+		state.moveTo(state.offsetAt(f, mouse.X-text_x), true)
+		if Platform.MouseReleased(sdl.BUTTON_LEFT) { CurrentUI.SetHot(nil, false) }
+	}
+
+	if CurrentUI.Mode == IM_MOUSE && n.HasMouse() {
+		CurrentUI.SetActive(n, false)
+		if Platform.MousePressed(sdl.BUTTON_LEFT) {
+			CurrentUI.SetHot(n, false)
+			CurrentUI.SetFocus(n)
+			state.moveTo(state.offsetAt(f, mouse.X-text_x), Platform.KeyMods()&KM_SHIFT != 0)
+			state.typing = false
+			state.lastEdit = CurrentUI.FrameStart
+		}
+	}
+
+	if !n.HasFocus() { return }
+
+	// Scroll the text so that the cursor stays visible
+	composition := Platform.TextComposition
+	cursor := Platform.MeasureWidth(f, state.display(state.Cursor)+composition) + 1
+	width := Platform.MeasureWidth(f, state.display(len(state.Value))+composition) + 1
+	inner := n.RealSize.X - n.Padding.xPadding()
+	state.Scroll = Clamp(state.Scroll, cursor-inner, cursor)
+	state.Scroll = Clamp(state.Scroll, 0, Max(width-inner, 0))
+
+	x := n.Pos.X + n.Padding.Left + cursor - state.Scroll
+	Platform.SetTextInputRect(x, n.Pos.Y, 1, n.RealSize.Y)
+}
+
+func textInputRenderFn(n *Node) {
+	state := NodeState[TextInputState](n)
+	s := n.GetStyle()
+	f := n.GetFont()
+	focused := n.HasFocus()
+	drawNodeRectBg(n.Pos, n.RealSize, s, focused || CurrentUI.Active == n.UID)
+
+	defer clipToContent(n)()
+
+	x := n.Pos.X + n.Padding.Left - state.Scroll
+	y := n.Pos.Y + n.Padding.Top
+	fg := s.Foreground.Normal
+	Platform.RawSetFont(f)
+
+	composition := ""
+	if focused { composition = Platform.TextComposition }
+
+	if state.Value == "" && composition == "" && state.Options.Placeholder != "" {
+		c := fg
+		c.A /= 2
+		Platform.SetColor(c)
+		Platform.DrawText(state.Options.Placeholder, x, y)
+	}
+
+	if focused && state.hasSelection() {
+		start, end := state.selection()
+		x1 := x + Platform.MeasureWidth(f, state.display(start))
+		x2 := x + Platform.MeasureWidth(f, state.display(end))
+		c := n.focusRingColor()
+		c.A = 96
+		Platform.SetColor(c)
+		Platform.DrawRectFilled(x1, y, x2-x1, f.Height)
+	}
+
+	before := state.display(state.Cursor)
+	after := state.display(len(state.Value))[len(before):]
+	Platform.SetColor(fg)
+	if text := before + composition + after; text != "" { Platform.DrawText(text, x, y) }
+
+	// The text that is being composed is underlined
+	before_w := Platform.MeasureWidth(f, before)
+	if composition != "" {
+		Platform.DrawRectFilled(x+before_w, y+f.Height-1, Platform.MeasureWidth(f, composition), 1)
+	}
+
+	blink := (CurrentUI.FrameStart-state.lastEdit)/CURSOR_BLINK%2 == 0
+	if focused && blink {
+		runes := []rune(composition)
+		composed := string(runes[:Clamp(Platform.TextCompositionCursor, 0, len(runes))])
+		cursor_x := x + before_w + Platform.MeasureWidth(f, composed)
+		Platform.DrawRectFilled(cursor_x, y, 1, f.Height)
+	}
+}
+
+// Clips drawing to the content rect of the node (and the current
+// clip rect). Returns a function that restores the clip rect.
+func clipToContent(n *Node) func() {
+	parent_clip := Platform.Renderer.GetClipRect()
+	clipped := Platform.Renderer.IsClipEnabled()
+	rect := n.contentRect()
+	if clipped { rect, _ = rect.Intersect(&parent_clip) }
+	Platform.Renderer.SetClipRect(&rect)
+
+	return func() {
+		if clipped {
+			Platform.Renderer.SetClipRect(&parent_clip)
+		} else {
+			Platform.Renderer.SetClipRect(nil)
+		}
+	}
+}
+
+// A single line text input. Returns the new value, whether it
+// changed in this frame, and whether Enter was pressed.
+func TextInput(value string, opts ...TextInputOptions) (string, *Node, bool, bool) {
+	n := CurrentUI.Push("text_input")
+	defer CurrentUI.Pop(n)
+
+	n.Flags.Focusable = true
+	n.Flags.TextInput = true
+	n.Style = &TextInputStyle
+	n.Padding = Padding2(6, 4)
+	n.Size.W = Em(12)
+	n.Size.H = Em(1)
+	n.RenderFn = textInputRenderFn
+	n.UpdateFn = textInputUpdateFn
+
+	state := NodeState[TextInputState](n)
+	state.Options = TextInputOptions{}
+	if len(opts) > 0 { state.Options = opts[0] }
+	if state.Value != value { state.reset(value) }
+
+	if !n.HasFocus() { return value, n, false, false }
+	changed, submitted := state.handleKeys()
+	return state.Value, n, changed, submitted
+}
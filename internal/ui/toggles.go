@@ -0,0 +1,165 @@
+package ui
+
+import (
+	. "github.com/glupi-borna/soko/internal/platform"
+	. "github.com/glupi-borna/soko/internal/utils"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// Speed of the toggle knob, for AnimateSPD
+const TOGGLE_SPEED = 256
+
+// State of the node that draws a checkbox, toggle or radio
+// button. Also marks the highlighted option of a Select.
+type CheckState struct {
+	Checked bool
+}
+
+// Returns the color between a and b, at t from a.
+func mixColor(a, b sdl.Color, t float32) sdl.Color {
+	mix := func(a, b uint8) uint8 { return uint8(float32(a) + (float32(b)-float32(a))*t) }
+	return sdl.Color{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), mix(a.A, b.A)}
+}
+
+// Draws the box of a checkbox, which is filled when it is checked.
+func checkboxRenderFn(n *Node) {
+	s := n.GetStyle()
+	hov := n.Parent.Focused()
+	drawNodeRectBg(n.Pos, n.RealSize, s, hov)
+
+	t := Animate(Btof(NodeState[CheckState](n).Checked), n.UID+"-check")
+	if t < 0.01 { return }
+	inset := n.RealSize.X * (.5 - .3*t)
+	size := V2{X: n.RealSize.X - inset*2, Y: n.RealSize.Y - inset*2}
+	pos := V2{X: n.Pos.X + inset, Y: n.Pos.Y + inset}
+	drawNodeRect(pos, size, s.CornerRadius, s.Foreground, StyleVariant[sdl.Color]{}, hov)
+}
+
+// Draws the circle of a radio button, with a dot when it is selected.
+func radioRenderFn(n *Node) {
+	s := n.GetStyle()
+	hov := n.Parent.Focused()
+	radius := StyleVar(n.RealSize.X / 2)
+	drawNodeRect(n.Pos, n.RealSize, radius, s.Background, s.Border, hov)
+
+	t := Animate(Btof(NodeState[CheckState](n).Checked), n.UID+"-check")
+	if t < 0.01 { return }
+	r := n.RealSize.X * .25 * t
+	c := n.center()
+	drawNodeRect(
+		V2{X: c.X - r, Y: c.Y - r}, V2{X: r * 2, Y: r * 2},
+		StyleVar(r), s.Foreground, StyleVariant[sdl.Color]{}, hov)
+}
+
+// Draws the track of a toggle, which takes the focus ring color when
+// the toggle is on, and the knob, which slides to the side that is on.
+func toggleRenderFn(n *Node) {
+	s := n.GetStyle()
+	hov := n.Focused()
+	t := AnimateSPD(Btof(NodeState[CheckState](n).Checked), TOGGLE_SPEED, n.UID+"-knob")
+
+	radius := n.RealSize.Y / 2
+	bg := s.Background
+	bg.Normal = mixColor(bg.Normal, n.focusRingColor(), t)
+	bg.Active = mixColor(bg.Active, n.focusRingColor(), t)
+	drawNodeRect(n.Pos, n.RealSize, StyleVar(radius), bg, s.Border, hov)
+
+	knob := radius - 2
+	x := n.Pos.X + 2 + (n.RealSize.X-knob*2-4)*t
+	drawNodeRect(
+		V2{X: x, Y: n.Pos.Y + 2}, V2{X: knob * 2, Y: knob * 2},
+		StyleVar(knob), s.Foreground, StyleVariant[sdl.Color]{}, hov)
+}
+
+// Pushes a focusable row, which holds the mark of a checkbox
+// or radio button (drawn by render), and its label.
+func labeledMark(t string, label string, checked bool, style *Style, render func(*Node)) *Node {
+	n := CurrentUI.Push(t)
+	defer CurrentUI.Pop(n)
+
+	n.Flags.Focusable = true
+	n.Layout = LT_HORIZONTAL
+	n.Gap = Gap1(6)
+	n.Padding = Padding2(2, 2)
+	n.Size.W = ChildrenSize()
+	n.Size.H = ChildrenSize()
+	n.RenderFn = nil
+
+	mark := CurrentUI.Push(t + "_mark")
+	mark.Style = style
+	mark.Size.W = Em(1)
+	mark.Size.H = Em(1)
+	mark.RenderFn = render
+	NodeState[CheckState](mark).Checked = checked
+	CurrentUI.Pop(mark)
+
+	if label != "" { Text(label) }
+	return n
+}
+
+// A checkbox with a label, which toggles when it, or the label,
+// is clicked. Returns the new value, and whether it changed.
+func Checkbox(label string, value bool) (bool, *Node, bool) {
+	n := labeledMark("checkbox", label, value, &CheckboxStyle, checkboxRenderFn)
+	if !n.Clicked() { return value, n, false }
+	NodeState[CheckState](n.Children[0]).Checked = !value
+	return !value, n, true
+}
+
+// A switch that slides on and off. Returns the new value, and whether it changed.
+func Toggle(value bool) (bool, *Node, bool) {
+	n := CurrentUI.Push("toggle")
+	defer CurrentUI.Pop(n)
+
+	n.Flags.Focusable = true
+	n.Style = &ToggleStyle
+	n.Size.W = Em(2)
+	n.Size.H = Em(1)
+	n.RenderFn = toggleRenderFn
+
+	changed := n.Clicked()
+	if changed { value = !value }
+	NodeState[CheckState](n).Checked = value
+	return value, n, changed
+}
+
+// A column of radio buttons, one for each option. Returns the selected
+// option, and whether it changed. The arrow keys select the previous
+// or next option while one of the radio buttons is focused.
+func RadioGroup(options []string, selected string) (string, *Node, bool) {
+	n := CurrentUI.Push("radio_group")
+	defer CurrentUI.Pop(n)
+
+	n.Layout = LT_VERTICAL
+	n.Padding = Padding1(0)
+	n.Gap = Gap1(2)
+	n.Size.W = ChildrenSize()
+	n.Size.H = ChildrenSize()
+	n.RenderFn = nil
+
+	next := -1
+	for i, option := range options {
+		radio := labeledMark("radio", option, option == selected, &RadioStyle, radioRenderFn)
+		if radio.Clicked() { next = i }
+		if !radio.HasFocus() { continue }
+
+		step := 0
+		switch {
+		case Platform.ComboPressed("Up"), Platform.ComboPressed("Left"): step = -1
+		case Platform.ComboPressed("Down"), Platform.ComboPressed("Right"): step = 1
+		}
+		// At the ends of the group, the arrows move focus out of it
+		if step != 0 && i+step >= 0 && i+step < len(options) {
+			next = i + step
+			CurrentUI.ConsumeNav()
+		}
+	}
+
+	if next == -1 || options[next] == selected { return selected, n, false }
+
+	for i, radio := range n.Children {
+		NodeState[CheckState](radio.Children[0]).Checked = i == next
+	}
+	CurrentUI.SetFocus(n.Children[next])
+	return options[next], n, true
+}
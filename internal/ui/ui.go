@@ -3,7 +3,9 @@ package ui
 import (
 	. "github.com/glupi-borna/soko/internal/debug"
 	. "github.com/glupi-borna/soko/internal/platform"
+	. "github.com/glupi-borna/soko/internal/utils"
 	"math"
+	"strings"
 	"time"
 )
 
@@ -11,8 +13,9 @@ var CurrentUI *UI_State
 
 func MakeUI() *UI_State {
 	ui := &UI_State{
-		Data:      make(map[string]any, 1000),
-		AnimState: make(map[string]float32, 100),
+		Data:      make(map[string]*StateEntry, 1000),
+		AnimState: make(map[string]*AnimEntry, 100),
+		StateTTL:  DEFAULT_STATE_TTL,
 	}
 	return ui
 }
@@ -26,14 +29,14 @@ func InterpolateSPD(old, new, spd float32) float32 {
 // Smoothly animates a value
 func AnimateSPD(val, spd float32, id string) float32 {
 	Assert(CurrentUI != nil, "UI not initialized!")
-	old, ok := CurrentUI.AnimState[id]
+	entry, ok := CurrentUI.AnimState[id]
 	if !ok {
-		CurrentUI.AnimState[id] = val
+		CurrentUI.AnimState[id] = &AnimEntry{Value: val, Frame: CurrentUI.Frame}
 		return val
 	}
-	new := InterpolateSPD(old, val, spd)
-	CurrentUI.AnimState[id] = new
-	return new
+	entry.Value = InterpolateSPD(entry.Value, val, spd)
+	entry.Frame = CurrentUI.Frame
+	return entry.Value
 }
 
 func Interpolate(old, new float32) float32 {
@@ -62,21 +65,42 @@ func Pulse(seconds float64) bool {
 	return current_pulse%2 == 1
 }
 
+// Frames after which state that was not touched is removed,
+// about 10 seconds at 60 frames per second.
+const DEFAULT_STATE_TTL = 600
+
+type StateEntry struct {
+	Value any
+	// Frame in which the entry was last touched
+	Frame uint64
+}
+
+type AnimEntry struct {
+	Value float32
+	// Frame in which the entry was last touched
+	Frame uint64
+}
+
+// Implemented by node state that owns resources, which
+// have to be released when the state is removed.
+type StateCleanup interface {
+	Cleanup()
+}
+
 func NodeState[K any](n *Node) *K {
 	Assert(CurrentUI != nil, "UI not initialized!")
 
-	var val K
-
-	data, ok := CurrentUI.Data[n.UID]
+	entry, ok := CurrentUI.Data[n.UID]
 	if !ok {
-		data = &val
-		CurrentUI.Data[n.UID] = data
+		entry = &StateEntry{}
+		CurrentUI.Data[n.UID] = entry
 	}
+	entry.Frame = CurrentUI.Frame
 
-	ptr, ok := data.(*K)
+	ptr, ok := entry.Value.(*K)
 	if !ok {
-		CurrentUI.Data[n.UID] = val
-		ptr = &val
+		ptr = new(K)
+		entry.Value = ptr
 	}
 
 	return ptr
@@ -84,13 +108,49 @@ func NodeState[K any](n *Node) *K {
 
 func NodeStateAny(n *Node) any {
 	Assert(CurrentUI != nil, "UI not initialized!")
-	data, ok := CurrentUI.Data[n.UID]
+	entry, ok := CurrentUI.Data[n.UID]
 	if !ok {
 		return nil
 	}
-	return data
+	entry.Frame = CurrentUI.Frame
+	return entry.Value
+}
+
+// Removes state that was not touched in the last StateTTL frames.
+func (ui *UI_State) sweepState() {
+	if ui.StateTTL == 0 || ui.Frame < ui.StateTTL { return }
+	oldest := ui.Frame - ui.StateTTL
+
+	for uid, entry := range ui.Data {
+		if entry.Frame >= oldest { continue }
+		if c, ok := entry.Value.(StateCleanup); ok { c.Cleanup() }
+		delete(ui.Data, uid)
+		ui.swept++
+	}
+
+	for id, entry := range ui.AnimState {
+		if entry.Frame >= oldest { continue }
+		delete(ui.AnimState, id)
+		ui.swept++
+	}
 }
 
+type StateStats struct {
+	Data, Anim int
+	// Number of entries that were removed so far
+	Swept int
+}
+
+func (ui *UI_State) Stats() StateStats {
+	return StateStats{
+		Data:  len(ui.Data),
+		Anim:  len(ui.AnimState),
+		Swept: ui.swept,
+	}
+}
+
+func Stats() StateStats { return CurrentUI.Stats() }
+
 type INPUT_MODE uint8
 
 const (
@@ -101,12 +161,24 @@ const (
 type UI_State struct {
 	Mode INPUT_MODE
 
-	Data      map[string]any
-	AnimState map[string]float32
+	Data      map[string]*StateEntry
+	AnimState map[string]*AnimEntry
+
+	// Number of the current frame
+	Frame uint64
+	// Frames after which untouched state is removed (0 keeps it forever)
+	StateTTL uint64
+	swept    int
 
 	Root, Current, Last *Node
 
 	Active, Hot, ScrollTarget                      string
+	// UID of the node with keyboard focus
+	Focus string
+	// Set when a node used the arrow keys, so they do not move focus
+	navConsumed bool
+	// Set when the focused node takes typed text
+	typing bool
 	ActiveChanged, HotChanged, ScrollTargetChanged bool
 
 	LastFrameStart,
@@ -114,12 +186,29 @@ type UI_State struct {
 
 	renderWidth,
 	renderHeight float32
+
+	// Size that fits the root and the overlays
+	windowWidth,
+	windowHeight float32
+
+	// Absolutely positioned nodes, in tree order
+	floating []*Node
+	// Topmost node under the mouse
+	hovered *Node
+
+	// Key for the next node (see Key)
+	nextKey string
+	// IDs pushed with PushID
+	idStack []string
+	// Prefix for UIDs of nodes created in the current ID scope
+	idScope string
 }
 
 func (ui *UI_State) Reset() {
 	ui.ActiveChanged = false
 	ui.HotChanged = false
 	ui.ScrollTargetChanged = false
+	ui.navConsumed = false
 }
 
 // Pushes a node on the UI stack.
@@ -130,6 +219,34 @@ func (ui *UI_State) Push(t string) (n *Node) {
 	return
 }
 
+// Sets the key of the next node. The UID of a keyed node is derived
+// from the key instead of its index, so that it keeps its state when
+// its siblings are added, removed or reordered.
+func (ui *UI_State) Key(key string) {
+	ui.nextKey = key
+}
+
+// Scopes the UIDs of the nodes that are created until the matching
+// PopID, so that e.g. the nodes of a list item can be told apart
+// from the nodes of the other items.
+func (ui *UI_State) PushID(id string) {
+	ui.idStack = append(ui.idStack, id)
+	ui.idScope = strings.Join(ui.idStack, "/") + ":"
+}
+
+func (ui *UI_State) PopID() {
+	Assert(len(ui.idStack) > 0, "PopID without PushID!")
+	ui.idStack = ui.idStack[:len(ui.idStack)-1]
+	ui.idScope = ""
+	if len(ui.idStack) > 0 {
+		ui.idScope = strings.Join(ui.idStack, "/") + ":"
+	}
+}
+
+func Key(key string)  { CurrentUI.Key(key) }
+func PushID(id string) { CurrentUI.PushID(id) }
+func PopID()           { CurrentUI.PopID() }
+
 // Pops a node off the UI stack.
 func (ui *UI_State) Pop(n *Node) *Node {
 	ui.Current = n.Parent
@@ -186,7 +303,12 @@ func (ui *UI_State) Begin(millis uint64) {
 	ui.LastFrameStart = ui.FrameStart
 	ui.FrameStart = time.Duration(millis * 1000 * 1000 / TIME_DIV)
 	ui.Delta = ui.FrameStart - ui.LastFrameStart
+	ui.Frame++
 	ui.Reset()
+	ui.floating = ui.floating[:0]
+	ui.nextKey = ""
+	ui.idStack = ui.idStack[:0]
+	ui.idScope = ""
 	ui.Root = GetNode("root", nil)
 	ui.Root.UpdateFn = rootUpdateFn
 	ui.Root.RenderFn = rootRenderFn
@@ -200,6 +322,9 @@ func (ui *UI_State) End() {
 	if ui.Current != ui.Root {
 		panic("Unbalanced UI stack!")
 	}
+	if len(ui.idStack) != 0 {
+		panic("Unbalanced ID stack!")
+	}
 
 	ui.Root.preLayout()
 
@@ -208,6 +333,8 @@ func (ui *UI_State) End() {
 	ui.Root.resolveDownwards()
 	ui.Root.resolveViolations()
 	ui.Root.resolvePos()
+	ui.resolveFloating()
+	ui.hitTest()
 
 	if Platform.MouseDelta.ManhattanLength() > 5 {
 		ui.Mode = IM_MOUSE
@@ -217,13 +344,55 @@ func (ui *UI_State) End() {
 	}
 
 	ui.Root.UpdateFn(ui.Root)
+	ui.navigateFocus()
+	focused := ui.Root.Find(func(n *Node) bool { return n.UID == ui.Focus })
+	ui.typing = focused != nil && focused.Flags.TextInput
+	if ui.Mode == IM_KBD { ui.Active = ui.Focus }
+	ui.sweepState()
+}
+
+// Positions the absolute nodes, and grows the window size to fit
+// them. They are in tree order, so the nodes that they are relative
+// to have been positioned (and moved) before.
+func (ui *UI_State) resolveFloating() {
+	ui.windowWidth, ui.windowHeight = ui.Root.RealSize.X, ui.Root.RealSize.Y
+	for _, f := range ui.floating {
+		f.resolveAbsolutePos()
+		if f.PostLayout != nil {
+			f.PostLayout(f)
+			f.resolvePos()
+		}
+		ui.windowWidth = Max(ui.windowWidth, f.Pos.X+f.RealSize.X)
+		ui.windowHeight = Max(ui.windowHeight, f.Pos.Y+f.RealSize.Y)
+	}
+}
+
+// Finds the topmost node under the mouse. Overlays are drawn after
+// the rest of the tree, so they are tested first, in reverse order.
+func (ui *UI_State) hitTest() {
+	mx, my := Platform.MousePos.X, Platform.MousePos.Y
+	for i := len(ui.floating) - 1; i >= 0; i-- {
+		ui.hovered = ui.floating[i].hitTest(mx, my)
+		if ui.hovered != nil { return }
+	}
+	ui.hovered = ui.Root.hitTest(mx, my)
 }
 
 func (ui *UI_State) Render() {
-	ui.Root.Render()
-	rw, rh := int32(ui.Root.RealSize.X), int32(ui.Root.RealSize.Y)
+	// Resized before drawing, so that overlays
+	// are not clipped in the frame they appear
+	rw, rh := int32(ui.windowWidth), int32(ui.windowHeight)
 	if rw > 0 && rh > 0 {
 		Platform.ResizeWindow(rw, rh)
 	}
+
+	ui.Root.Render()
+
+	// Overlays escape the clip rects of their ancestors
+	for _, f := range ui.floating {
+		Platform.Renderer.SetClipRect(nil)
+		f.Render()
+	}
+
 	Platform.EndFrame()
 }
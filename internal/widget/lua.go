@@ -2,6 +2,7 @@ package widget
 
 import (
 	"fmt"
+	"net"
 	"reflect"
 	"errors"
 
@@ -20,6 +21,16 @@ type LuaWidget struct {
 	frameFn *lua.LFunction
 	cleanUpFn *lua.LFunction
 	reloadQueued bool
+
+	listener net.Listener
+	replQueue chan replRequest
+	// Closed by closeREPL
+	replDone chan struct{}
+	replClients map[*replClient]bool
+
+	// Called after the environment is exposed, before the
+	// widget file is run. Used by the test runner to install mocks.
+	prepare func()
 }
 
 func MakeLuaWidget(name, path string) *LuaWidget {
@@ -118,22 +129,9 @@ func luaStyleVar[K any](val lua.LValue, convert func(lua.LValue)(K, bool)) ui.St
 	return sv
 }
 
-func (lw *LuaWidget) Name() string { return lw.name }
-func (lw *LuaWidget) Path() string { return lw.path }
-func (lw *LuaWidget) Type() string { return "lua" }
-
-func (lw *LuaWidget) Expose(name string, val any) {
-	lw.l.SetGlobal(name, luar.New(lw.l, val))
-}
-
-func (lw *LuaWidget) init() error {
-	if lw.l == nil { lw.l = lua.NewState() }
-
-	fn, err := lw.l.LoadFile(lw.path)
-	if err != nil { return err }
-
-	ExposeEnvironment(lw)
-
+// Exposes the parts of the environment that are specific
+// to lua widgets.
+func ExposeLuaEnvironment(e Exposer) {
 	NodeIter := func (iterable *ui.Node, item *ui.Node) *ui.Node {
 		if item == nil { return iterable }
 		if item == iterable {
@@ -143,11 +141,11 @@ func (lw *LuaWidget) init() error {
 		return nil
 	}
 
-	lw.l.SetGlobal("With", luar.New(lw.l, func(n *ui.Node) (any, any, any) {
+	e.Expose("With", func(n *ui.Node) (any, any, any) {
 		return NodeIter, n, nil
-	}))
+	})
 
-	lw.l.SetGlobal("Style", luar.New(lw.l, func(arg *lua.LTable) *ui.Style {
+	e.Expose("Style", func(arg *lua.LTable) *ui.Style {
 		s := ui.DefaultStyle.Copy()
 
 		bg := arg.RawGetString("Background")
@@ -180,7 +178,28 @@ func (lw *LuaWidget) init() error {
 		}
 
 		return s
-	}))
+	})
+}
+
+func (lw *LuaWidget) Name() string { return lw.name }
+func (lw *LuaWidget) Path() string { return lw.path }
+func (lw *LuaWidget) Type() string { return "lua" }
+
+func (lw *LuaWidget) Expose(name string, val any) {
+	lw.l.SetGlobal(name, luar.New(lw.l, val))
+}
+
+func (lw *LuaWidget) init() error {
+	if lw.l == nil { lw.l = lua.NewState() }
+
+	fn, err := lw.l.LoadFile(lw.path)
+	if err != nil { return err }
+
+	ExposeEnvironment(lw)
+	ExposeLuaEnvironment(lw)
+	lw.l.SetGlobal("print", lw.l.NewFunction(lw.print))
+
+	if lw.prepare != nil { lw.prepare() }
 
 	lw.l.Push(fn)
 	err = lw.l.PCall(0, lua.MultRet, nil)
@@ -238,6 +257,9 @@ func (lw *LuaWidget) Init() error {
 	err = watcher.Add(lw.path)
 	if err != nil { return err }
 
+	err = lw.listen()
+	if err != nil { println("REPL disabled:", err.Error()) }
+
 	return nil
 }
 
@@ -280,7 +302,13 @@ func (lw *LuaWidget) Frame() error {
 	return err
 }
 
+func (lw *LuaWidget) Idle() error {
+	lw.serveREPL()
+	return nil
+}
+
 func (lw *LuaWidget) Cleanup() error {
+	lw.closeREPL()
 	_, err := lw.CallFn(lw.cleanUpFn)
 	if err != nil { return err }
 	lw.l.Close()
@@ -0,0 +1,379 @@
+package widget
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// Maximum depth up to which nested tables and Go values are printed.
+const replPrintDepth = 3
+
+// Maximum number of items printed for tables, slices and maps.
+const replPrintItems = 32
+
+type replClient struct {
+	conn net.Conn
+	// Lines of an incomplete chunk
+	buf string
+}
+
+type replRequest struct {
+	client *replClient
+	line   string
+	closed bool
+}
+
+// Returns the path of the unix socket on which a running
+// widget accepts REPL clients.
+func SocketPath(name string) string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" { dir = os.TempDir() }
+	return filepath.Join(dir, "soko-"+name+".sock")
+}
+
+// Connects to the REPL of a running widget, sending lines from in
+// and writing everything the widget sends back to out.
+func Attach(name string, in io.Reader, out io.Writer) error {
+	conn, err := net.Dial("unix", SocketPath(name))
+	if err != nil { return err }
+	defer conn.Close()
+
+	done := make(chan struct{})
+	go func() {
+		io.Copy(out, conn)
+		close(done)
+	}()
+
+	_, err = io.Copy(conn, in)
+	if err != nil { return err }
+	conn.(*net.UnixConn).CloseWrite()
+	<-done
+	return nil
+}
+
+// Starts accepting REPL clients. Requests are queued, and
+// evaluated between frames by serveREPL.
+func (lw *LuaWidget) listen() error {
+	path := SocketPath(lw.name)
+
+	// A socket file that nobody is listening on was left
+	// behind by an instance that did not exit cleanly.
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("REPL socket %s is already in use", path)
+	}
+	os.Remove(path)
+
+	listener, err := net.Listen("unix", path)
+	if err != nil { return err }
+
+	lw.listener = listener
+	lw.replQueue = make(chan replRequest, 16)
+	lw.replDone = make(chan struct{})
+	lw.replClients = make(map[*replClient]bool)
+
+	queue, done := lw.replQueue, lw.replDone
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil { return }
+			client := &replClient{conn: conn}
+			if !sendREPL(queue, done, replRequest{client: client}) {
+				conn.Close()
+				return
+			}
+			go readREPL(queue, done, client)
+		}
+	}()
+
+	return nil
+}
+
+// Queues the request, unless the REPL is closed (done is closed)
+// before it is taken. Returns false if it was not queued.
+func sendREPL(queue chan replRequest, done chan struct{}, req replRequest) bool {
+	select {
+	case queue <- req: return true
+	case <-done: return false
+	}
+}
+
+func readREPL(queue chan replRequest, done chan struct{}, client *replClient) {
+	scanner := bufio.NewScanner(client.conn)
+	for scanner.Scan() {
+		if !sendREPL(queue, done, replRequest{client: client, line: scanner.Text()}) {
+			client.conn.Close()
+			return
+		}
+	}
+	sendREPL(queue, done, replRequest{client: client, closed: true})
+}
+
+// Evaluates queued REPL requests. Must be called from the
+// thread that runs the widget.
+func (lw *LuaWidget) serveREPL() {
+	if lw.replQueue == nil { return }
+
+	for {
+		select {
+		case req := <-lw.replQueue:
+			switch {
+			case req.closed:
+				req.client.conn.Close()
+				delete(lw.replClients, req.client)
+			case lw.replClients[req.client]:
+				lw.eval(req.client, req.line)
+			default:
+				lw.replClients[req.client] = true
+				req.client.write("Attached to " + lw.name + "\n> ")
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (lw *LuaWidget) closeREPL() {
+	if lw.listener == nil { return }
+	lw.listener.Close()
+	// Unblocks the goroutines that still wait to queue requests
+	close(lw.replDone)
+	os.Remove(SocketPath(lw.name))
+	for client := range lw.replClients {
+		client.conn.Close()
+	}
+	lw.replClients = make(map[*replClient]bool)
+	lw.replQueue = nil
+	lw.listener = nil
+}
+
+func (c *replClient) write(s string) {
+	c.conn.Write([]byte(s))
+}
+
+func (lw *LuaWidget) eval(c *replClient, line string) {
+	c.buf += line + "\n"
+	src := c.buf
+
+	// Expressions are evaluated as return statements,
+	// so that their values can be printed.
+	fn, err := lw.l.LoadString("return " + src)
+	if err != nil {
+		fn, err = lw.l.LoadString(src)
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "at EOF") {
+			c.write(">> ")
+			return
+		}
+		c.buf = ""
+		c.write(err.Error() + "\n> ")
+		return
+	}
+	c.buf = ""
+
+	top := lw.l.GetTop()
+	lw.l.Push(fn)
+	err = lw.l.PCall(0, lua.MultRet, nil)
+	if err != nil {
+		lw.l.SetTop(top)
+		c.write(err.Error() + "\n> ")
+		return
+	}
+
+	b := strings.Builder{}
+	for i := top + 1; i <= lw.l.GetTop(); i++ {
+		prettyLua(&b, lw.l.Get(i), 0)
+		b.WriteString("\n")
+	}
+	lw.l.SetTop(top)
+
+	b.WriteString("> ")
+	c.write(b.String())
+}
+
+// Replaces print(), so that output is mirrored to attached REPL clients.
+func (lw *LuaWidget) print(L *lua.LState) int {
+	b := strings.Builder{}
+	for i := 1; i <= L.GetTop(); i++ {
+		if i > 1 { b.WriteString("\t") }
+		b.WriteString(L.ToStringMeta(L.Get(i)).String())
+	}
+	b.WriteString("\n")
+	out := b.String()
+
+	os.Stdout.WriteString(out)
+	for client := range lw.replClients {
+		client.write(out)
+	}
+	return 0
+}
+
+func writeIndent(b *strings.Builder, depth int) {
+	for i := 0; i < depth; i++ { b.WriteString("  ") }
+}
+
+func prettyLua(b *strings.Builder, v lua.LValue, depth int) {
+	switch val := v.(type) {
+	case lua.LString:
+		b.WriteString(strconv.Quote(string(val)))
+
+	case *lua.LUserData:
+		prettyGo(b, reflect.ValueOf(val.Value), depth, make(map[uintptr]bool))
+
+	case *lua.LTable:
+		if depth >= replPrintDepth {
+			b.WriteString("{…}")
+			return
+		}
+		b.WriteString("{\n")
+		count := 0
+		val.ForEach(func(key, item lua.LValue) {
+			count++
+			if count > replPrintItems { return }
+			writeIndent(b, depth+1)
+			if s, ok := key.(lua.LString); ok {
+				b.WriteString(string(s))
+			} else {
+				b.WriteString("[" + key.String() + "]")
+			}
+			b.WriteString(" = ")
+			prettyLua(b, item, depth+1)
+			b.WriteString(",\n")
+		})
+		if count > replPrintItems {
+			writeIndent(b, depth+1)
+			b.WriteString("… " + strconv.Itoa(count-replPrintItems) + " more\n")
+		}
+		writeIndent(b, depth)
+		b.WriteString("}")
+
+	default:
+		b.WriteString(v.String())
+	}
+}
+
+// Prints a Go value exposed through luar. Pointers that were
+// already printed are not followed again, so cycles
+// (e.g. Node.Parent) terminate.
+func prettyGo(b *strings.Builder, v reflect.Value, depth int, seen map[uintptr]bool) {
+	if !v.IsValid() {
+		b.WriteString("nil")
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			b.WriteString("nil")
+			return
+		}
+		if seen[v.Pointer()] {
+			b.WriteString("&" + v.Elem().Type().String() + "{<cycle>}")
+			return
+		}
+		seen[v.Pointer()] = true
+		b.WriteString("&")
+		prettyGo(b, v.Elem(), depth, seen)
+
+	case reflect.Interface:
+		prettyGo(b, v.Elem(), depth, seen)
+
+	case reflect.Struct:
+		b.WriteString(v.Type().String())
+		if depth >= replPrintDepth {
+			b.WriteString("{…}")
+			return
+		}
+		b.WriteString("{\n")
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if !t.Field(i).IsExported() { continue }
+			writeIndent(b, depth+1)
+			b.WriteString(t.Field(i).Name + " = ")
+			prettyGo(b, v.Field(i), depth+1, seen)
+			b.WriteString(",\n")
+		}
+		writeIndent(b, depth)
+		b.WriteString("}")
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			b.WriteString("nil")
+			return
+		}
+		b.WriteString("[" + strconv.Itoa(v.Len()) + "]")
+		if v.Len() == 0 {
+			b.WriteString("{}")
+			return
+		}
+		if depth >= replPrintDepth {
+			b.WriteString("{…}")
+			return
+		}
+		b.WriteString("{\n")
+		for i := 0; i < v.Len() && i < replPrintItems; i++ {
+			writeIndent(b, depth+1)
+			prettyGo(b, v.Index(i), depth+1, seen)
+			b.WriteString(",\n")
+		}
+		if v.Len() > replPrintItems {
+			writeIndent(b, depth+1)
+			b.WriteString("… " + strconv.Itoa(v.Len()-replPrintItems) + " more\n")
+		}
+		writeIndent(b, depth)
+		b.WriteString("}")
+
+	case reflect.Map:
+		if v.IsNil() {
+			b.WriteString("nil")
+			return
+		}
+		if depth >= replPrintDepth {
+			b.WriteString("map{…}")
+			return
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+		})
+		b.WriteString("map{\n")
+		for i, key := range keys {
+			if i >= replPrintItems { break }
+			writeIndent(b, depth+1)
+			b.WriteString(fmt.Sprint(key) + " = ")
+			prettyGo(b, v.MapIndex(key), depth+1, seen)
+			b.WriteString(",\n")
+		}
+		writeIndent(b, depth)
+		b.WriteString("}")
+
+	case reflect.Func:
+		if v.IsNil() {
+			b.WriteString("nil")
+		} else {
+			b.WriteString(v.Type().String())
+		}
+
+	case reflect.String:
+		b.WriteString(strconv.Quote(v.String()))
+
+	default:
+		if v.CanInterface() {
+			b.WriteString(fmt.Sprint(v.Interface()))
+		} else {
+			b.WriteString(v.Type().String())
+		}
+	}
+}
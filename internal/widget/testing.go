@@ -0,0 +1,431 @@
+package widget
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/yuin/gopher-lua"
+	"layeh.com/gopher-luar"
+	"github.com/veandco/go-sdl2/sdl"
+	"github.com/glupi-borna/soko/internal/ui"
+	. "github.com/glupi-borna/soko/internal/platform"
+	. "github.com/glupi-borna/soko/internal/utils"
+)
+
+// Simulated duration of a single frame, in milliseconds.
+const testFrameMillis = 16
+
+type testCase struct {
+	name string
+	fn   *lua.LFunction
+}
+
+type testResult struct {
+	name     string
+	failures []string
+	duration time.Duration
+}
+
+type testMock struct {
+	ret   []lua.LValue
+	calls *lua.LTable
+}
+
+// Runs a widget headlessly, driving it with scripted input
+// from a soko_<name>_test.lua companion file.
+type testRunner struct {
+	lw      *LuaWidget
+	ui      *ui.UI_State
+	millis  uint64
+	tests   []testCase
+	mocks   map[string]*testMock
+	current *testResult
+	pending []func()
+}
+
+// Runs the tests in the widget's companion test file, and writes
+// the results to out in the given format ("tap" or "go").
+// Returns the number of failed tests.
+func RunTests(w Widget, out io.Writer, format string) (int, error) {
+	lw, ok := w.(*LuaWidget)
+	if !ok {
+		return 0, errors.New("Tests are not supported for " + w.Type() + " widgets")
+	}
+
+	test_path := TestPath(w)
+	_, err := os.Stat(test_path)
+	if err != nil { return 0, err }
+
+	r := testRunner{lw: lw}
+	lw.prepare = r.expose
+
+	err = r.load(test_path)
+	if err != nil { return 0, err }
+
+	results := make([]testResult, 0, len(r.tests))
+	for i := range r.tests {
+		results = append(results, r.run(test_path, i))
+	}
+	lw.l.Close()
+	lw.l = nil
+
+	switch format {
+	case "tap":
+		writeTAP(out, results)
+	case "go":
+		writeGoTest(out, results)
+	default:
+		return 0, errors.New("Unknown test output format: '" + format + "'")
+	}
+
+	failed := 0
+	for _, res := range results {
+		if len(res.failures) > 0 { failed++ }
+	}
+	return failed, nil
+}
+
+// Runs the test file in a new Lua state, which collects its mocks and
+// tests. The widget itself only runs in each test, after the mocks.
+func (r *testRunner) load(test_path string) error {
+	if r.lw.l != nil { r.lw.l.Close() }
+	r.lw.l = lua.NewState()
+	r.mocks = make(map[string]*testMock)
+	r.tests = r.tests[:0]
+	r.expose()
+	return r.lw.l.DoFile(test_path)
+}
+
+// Runs the test at index in a Lua state of its own, so that
+// the globals set by earlier tests do not leak into it.
+func (r *testRunner) run(test_path string, index int) testResult {
+	res := testResult{name: r.tests[index].name}
+	r.current = &res
+	defer func() { r.current = nil }()
+
+	err := r.load(test_path)
+	if err != nil || index >= len(r.tests) {
+		if err == nil { err = errors.New("the test file defined different tests") }
+		r.fail(err.Error())
+		return res
+	}
+	test := r.tests[index]
+
+	resetTestInput()
+	r.ui = ui.MakeUI()
+	ui.CurrentUI = r.ui
+	r.millis = 0
+
+	start := time.Now()
+
+	err = r.lw.init()
+	if err != nil {
+		r.fail(err.Error())
+	} else {
+		err = r.lw.l.CallByParam(lua.P{Fn: test.fn, NRet: 0, Protect: true})
+		if err != nil { r.fail(err.Error()) }
+		_, err = r.lw.CallFn(r.lw.cleanUpFn)
+		if err != nil { r.fail(err.Error()) }
+	}
+
+	res.duration = time.Since(start)
+	return res
+}
+
+func resetTestInput() {
+	Platform.Mouse = make(map[uint8]BUTTON_STATE)
+	Platform.Keyboard = make(map[uint32]BUTTON_STATE)
+	Platform.Modifiers = 0
+	Platform.MousePos = V2{X: -1, Y: -1}
+	Platform.ResetInput()
+}
+
+func (r *testRunner) fail(msg string) {
+	if r.current == nil {
+		println(msg)
+		return
+	}
+	r.current.failures = append(r.current.failures, msg)
+}
+
+// Runs a single frame of the widget, applying any scripted
+// input that was queued since the last frame.
+func (r *testRunner) frame() {
+	Platform.ResetInput()
+	for _, fn := range r.pending { fn() }
+	r.pending = r.pending[:0]
+
+	r.millis += testFrameMillis
+	r.ui.Begin(r.millis)
+	err := r.lw.Frame()
+	if err != nil {
+		r.fail(err.Error())
+		r.ui.Root.Children = nil
+		r.ui.Current = r.ui.Root
+	}
+	r.ui.End()
+	r.ui.Render()
+}
+
+func (r *testRunner) queue(fn func()) {
+	r.pending = append(r.pending, fn)
+}
+
+func (r *testRunner) find(query string) *ui.Node {
+	if r.ui.Root == nil { return nil }
+	return r.ui.Root.Find(func(n *ui.Node) bool {
+		return n.UID == query || (n.Text != "" && n.Text == query)
+	})
+}
+
+func (r *testRunner) moveMouse(x, y float32) {
+	r.queue(func() {
+		Platform.MouseDelta.X = x - Platform.MousePos.X
+		Platform.MouseDelta.Y = y - Platform.MousePos.Y
+		Platform.MousePos.X = x
+		Platform.MousePos.Y = y
+		r.ui.Mode = ui.IM_MOUSE
+	})
+	r.frame()
+}
+
+// Moves the mouse to the center of the node matching the query
+// in the first argument. Returns false if there is no such node.
+func (r *testRunner) moveTo(L *lua.LState) bool {
+	query := L.CheckString(1)
+	n := r.find(query)
+	if n == nil {
+		r.fail(L.Where(1) + "no node matches '" + query + "'")
+		return false
+	}
+	r.moveMouse(n.Pos.X+n.RealSize.X/2, n.Pos.Y+n.RealSize.Y/2)
+	return true
+}
+
+func (r *testRunner) mockFn(name string) *lua.LFunction {
+	return r.lw.l.NewFunction(func(L *lua.LState) int {
+		mock := r.mocks[name]
+		args := L.NewTable()
+		for i := 1; i <= L.GetTop(); i++ {
+			args.Append(L.Get(i))
+		}
+		mock.calls.Append(args)
+		for _, val := range mock.ret {
+			L.Push(val)
+		}
+		return len(mock.ret)
+	})
+}
+
+// Exposes the test API to the widget environment, and
+// installs the mocks that are currently registered.
+func (r *testRunner) expose() {
+	l := r.lw.l
+
+	for name := range r.mocks {
+		l.SetGlobal(name, r.mockFn(name))
+	}
+
+	l.SetGlobal("Test", l.NewFunction(func(L *lua.LState) int {
+		r.tests = append(r.tests, testCase{
+			name: L.CheckString(1),
+			fn:   L.CheckFunction(2),
+		})
+		return 0
+	}))
+
+	l.SetGlobal("Frames", l.NewFunction(func(L *lua.LState) int {
+		count := L.OptInt(1, 1)
+		for i := 0; i < count; i++ { r.frame() }
+		return 0
+	}))
+
+	l.SetGlobal("Find", l.NewFunction(func(L *lua.LState) int {
+		n := r.find(L.CheckString(1))
+		if n == nil {
+			L.Push(lua.LNil)
+		} else {
+			L.Push(luar.New(L, n))
+		}
+		return 1
+	}))
+
+	l.SetGlobal("MoveMouse", l.NewFunction(func(L *lua.LState) int {
+		r.moveMouse(float32(L.CheckNumber(1)), float32(L.CheckNumber(2)))
+		return 0
+	}))
+
+	l.SetGlobal("MoveTo", l.NewFunction(func(L *lua.LState) int {
+		r.moveTo(L)
+		return 0
+	}))
+
+	l.SetGlobal("Click", l.NewFunction(func(L *lua.LState) int {
+		if L.GetTop() > 0 && !r.moveTo(L) { return 0 }
+		btn := mouseButtonFromName(L.OptString(2, "left"))
+		r.queue(func() { Platform.Mouse[btn] = BS_PRESSED })
+		r.frame()
+		r.queue(func() { Platform.Mouse[btn] = BS_RELEASED })
+		r.frame()
+		return 0
+	}))
+
+	l.SetGlobal("MouseDown", l.NewFunction(func(L *lua.LState) int {
+		btn := mouseButtonFromName(L.OptString(1, "left"))
+		r.queue(func() { Platform.Mouse[btn] = BS_PRESSED })
+		r.frame()
+		return 0
+	}))
+
+	l.SetGlobal("MouseUp", l.NewFunction(func(L *lua.LState) int {
+		btn := mouseButtonFromName(L.OptString(1, "left"))
+		r.queue(func() { Platform.Mouse[btn] = BS_RELEASED })
+		r.frame()
+		return 0
+	}))
+
+	l.SetGlobal("Press", l.NewFunction(func(L *lua.LState) int {
+		combo := L.CheckString(1)
+		kc, err := ParseKeyCombo(combo)
+		if err != nil {
+			L.RaiseError(err.Error())
+			return 0
+		}
+		r.queue(func() {
+			Platform.Keyboard[kc.Key] = BS_PRESSED
+			Platform.Modifiers = testModifiers(kc.Mods)
+			Platform.AnyKeyPressed = true
+		})
+		r.frame()
+		r.queue(func() {
+			Platform.Keyboard[kc.Key] = BS_RELEASED
+			Platform.Modifiers = 0
+		})
+		r.frame()
+		return 0
+	}))
+
+	l.SetGlobal("Type", l.NewFunction(func(L *lua.LState) int {
+		text := L.CheckString(1)
+		r.queue(func() {
+			Platform.TextInput = text
+			Platform.AnyKeyPressed = true
+		})
+		r.frame()
+		return 0
+	}))
+
+	l.SetGlobal("Scroll", l.NewFunction(func(L *lua.LState) int {
+		x, y := float32(L.CheckNumber(1)), float32(L.CheckNumber(2))
+		r.queue(func() {
+			Platform.WheelDelta.X = x
+			Platform.WheelDelta.Y = y
+		})
+		r.frame()
+		return 0
+	}))
+
+	l.SetGlobal("Assert", l.NewFunction(func(L *lua.LState) int {
+		if !lua.LVAsBool(L.Get(1)) {
+			r.fail(L.Where(1) + L.OptString(2, "assertion failed"))
+		}
+		return 0
+	}))
+
+	l.SetGlobal("AssertEq", l.NewFunction(func(L *lua.LState) int {
+		actual, expected := L.Get(1), L.Get(2)
+		if !L.Equal(actual, expected) {
+			msg := "expected " + expected.String() + ", got " + actual.String()
+			if L.GetTop() > 2 { msg = L.CheckString(3) + ": " + msg }
+			r.fail(L.Where(1) + msg)
+		}
+		return 0
+	}))
+
+	l.SetGlobal("Mock", l.NewFunction(func(L *lua.LState) int {
+		name := L.CheckString(1)
+		mock := &testMock{calls: L.NewTable()}
+		for i := 2; i <= L.GetTop(); i++ {
+			mock.ret = append(mock.ret, L.Get(i))
+		}
+		r.mocks[name] = mock
+		L.SetGlobal(name, r.mockFn(name))
+		return 0
+	}))
+
+	l.SetGlobal("Calls", l.NewFunction(func(L *lua.LState) int {
+		name := L.CheckString(1)
+		mock, ok := r.mocks[name]
+		if !ok {
+			L.RaiseError("'" + name + "' is not mocked")
+			return 0
+		}
+		L.Push(mock.calls)
+		return 1
+	}))
+}
+
+func mouseButtonFromName(name string) uint8 {
+	switch strings.ToLower(name) {
+	case "middle": return sdl.BUTTON_MIDDLE
+	case "right": return sdl.BUTTON_RIGHT
+	default: return sdl.BUTTON_LEFT
+	}
+}
+
+func testModifiers(km KeyMod) (mod sdl.Keymod) {
+	if km&KM_CTRL != 0 { mod |= sdl.KMOD_LCTRL }
+	if km&KM_SHIFT != 0 { mod |= sdl.KMOD_LSHIFT }
+	if km&KM_ALT != 0 { mod |= sdl.KMOD_LALT }
+	if km&KM_SUPER != 0 { mod |= sdl.KMOD_LGUI }
+	return
+}
+
+func writeTAP(out io.Writer, results []testResult) {
+	fmt.Fprintln(out, "TAP version 13")
+	fmt.Fprintf(out, "1..%d\n", len(results))
+	for i, res := range results {
+		if len(res.failures) == 0 {
+			fmt.Fprintf(out, "ok %d - %s\n", i+1, res.name)
+			continue
+		}
+		fmt.Fprintf(out, "not ok %d - %s\n", i+1, res.name)
+		fmt.Fprintln(out, "  ---")
+		fmt.Fprintln(out, "  message: |")
+		for _, failure := range res.failures {
+			for _, line := range strings.Split(failure, "\n") {
+				fmt.Fprintln(out, "    "+line)
+			}
+		}
+		fmt.Fprintln(out, "  ...")
+	}
+}
+
+func writeGoTest(out io.Writer, results []testResult) {
+	failed := false
+	for _, res := range results {
+		name := strings.ReplaceAll(res.name, " ", "_")
+		secs := res.duration.Seconds()
+		fmt.Fprintln(out, "=== RUN   "+name)
+		if len(res.failures) == 0 {
+			fmt.Fprintf(out, "--- PASS: %s (%.2fs)\n", name, secs)
+			continue
+		}
+		failed = true
+		fmt.Fprintf(out, "--- FAIL: %s (%.2fs)\n", name, secs)
+		for _, failure := range res.failures {
+			for _, line := range strings.Split(failure, "\n") {
+				fmt.Fprintln(out, "    "+line)
+			}
+		}
+	}
+	if failed {
+		fmt.Fprintln(out, "FAIL")
+	} else {
+		fmt.Fprintln(out, "PASS")
+	}
+}
@@ -0,0 +1,294 @@
+package widget
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// Collects exposed values instead of exposing them,
+// so that their types can be described.
+type typeCollector struct {
+	names  []string
+	values map[string]any
+}
+
+func (c *typeCollector) Expose(name string, val any) {
+	if _, ok := c.values[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.values[name] = val
+}
+
+// Generates LuaCATS annotations (https://luals.github.io/wiki/annotations/)
+// for Go types that are exposed to Lua.
+type typeGen struct {
+	out     strings.Builder
+	seen    map[reflect.Type]string
+	queue   []reflect.Type
+	aliases map[string]string
+}
+
+var refTypeError = reflect.TypeOf((*error)(nil)).Elem()
+var refTypeLValue = reflect.TypeOf((*lua.LValue)(nil)).Elem()
+var refTypeLTable = reflect.TypeOf((*lua.LTable)(nil))
+var pkgPathRe = regexp.MustCompile(`[\w./-]*/(\w+)\.`)
+var invalidNameRe = regexp.MustCompile(`[^\w.]+`)
+
+// Writes a LuaCATS definition file describing the
+// environment that is exposed to lua widgets.
+func GenTypes(out io.Writer) error {
+	return WriteTypes(out, ExposeEnvironment, ExposeLuaEnvironment)
+}
+
+// Writes a LuaCATS definition file describing
+// the values exposed by the expose functions.
+func WriteTypes(out io.Writer, expose ...func(Exposer)) error {
+	c := typeCollector{values: make(map[string]any)}
+	for _, fn := range expose { fn(&c) }
+
+	g := typeGen{
+		seen:    make(map[reflect.Type]string),
+		aliases: make(map[string]string),
+	}
+
+	g.line("---@meta")
+	g.line("-- Generated by 'soko gen-types', do not edit.")
+	g.line("")
+
+	sort.Strings(c.names)
+	for _, name := range c.names {
+		g.global(name, c.values[name])
+	}
+
+	for len(g.queue) > 0 {
+		t := g.queue[0]
+		g.queue = g.queue[1:]
+		g.class(t)
+	}
+
+	alias_names := make([]string, 0, len(g.aliases))
+	for name := range g.aliases { alias_names = append(alias_names, name) }
+	sort.Strings(alias_names)
+	for _, name := range alias_names {
+		g.line("---@alias " + name + " " + g.aliases[name])
+	}
+
+	_, err := io.WriteString(out, g.out.String())
+	return err
+}
+
+func (g *typeGen) line(s string) {
+	g.out.WriteString(s)
+	g.out.WriteString("\n")
+}
+
+// Returns the lua name for a named Go type, e.g. "ui.Node" for ui.Node
+// or "ui.StyleVariant_sdl.Color" for ui.StyleVariant[sdl.Color].
+func typeName(t reflect.Type) string {
+	name := pkgPathRe.ReplaceAllString(t.Name(), "$1.")
+	name = strings.TrimSuffix(invalidNameRe.ReplaceAllString(name, "_"), "_")
+	if t.PkgPath() == "" { return name }
+	return path.Base(t.PkgPath()) + "." + name
+}
+
+// Returns true for named types, other than structs and
+// interfaces, that have methods (e.g. ui.ALIGN).
+func hasMethods(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Struct, reflect.Interface, reflect.Ptr: return false
+	}
+	return t.Name() != "" && reflect.PointerTo(t).NumMethod() > 0
+}
+
+// Returns the lua type of basic Go types, or "".
+func basicType(k reflect.Kind) string {
+	switch k {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return "integer"
+	}
+	return ""
+}
+
+// Returns the lua type annotation for a Go type, queueing any struct
+// and interface types, and named types with methods, for a class definition.
+func (g *typeGen) typeOf(t reflect.Type) string {
+	if t == refTypeLTable { return "table" }
+	if t.Implements(refTypeLValue) { return "any" }
+	if t == refTypeError || hasMethods(t) { return g.named(t) }
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.typeOf(t.Elem())
+
+	case reflect.Struct:
+		if t.Name() == "" { return "table" }
+		return g.named(t)
+
+	case reflect.Interface:
+		if t.NumMethod() == 0 { return "any" }
+		if t.Name() == "" { return "userdata" }
+		return g.named(t)
+
+	case reflect.Slice, reflect.Array:
+		return g.typeOf(t.Elem()) + "[]"
+
+	case reflect.Map:
+		return "table<" + g.typeOf(t.Key()) + ", " + g.typeOf(t.Elem()) + ">"
+
+	case reflect.Func:
+		return g.funcType(t, false)
+
+	case reflect.Chan:
+		return "userdata"
+	}
+
+	basic := basicType(t.Kind())
+	if basic == "" { return "any" }
+	if t.Name() == "" || t.PkgPath() == "" { return basic }
+	name := typeName(t)
+	g.aliases[name] = basic
+	return name
+}
+
+func (g *typeGen) named(t reflect.Type) string {
+	name, ok := g.seen[t]
+	if ok { return name }
+	name = typeName(t)
+	g.seen[t] = name
+	g.queue = append(g.queue, t)
+	return name
+}
+
+// Returns the parameter and return types of a function. Methods
+// have their receiver skipped.
+func (g *typeGen) signature(t reflect.Type, method bool) (params []string, rets []string) {
+	start := 0
+	if method { start = 1 }
+	for i := start; i < t.NumIn(); i++ {
+		in := t.In(i)
+		name := "arg" + strconv.Itoa(i-start+1)
+		if t.IsVariadic() && i == t.NumIn()-1 {
+			params = append(params, "...: "+g.typeOf(in.Elem()))
+			continue
+		}
+		params = append(params, name+": "+g.typeOf(in))
+	}
+	for i := 0; i < t.NumOut(); i++ {
+		rets = append(rets, g.typeOf(t.Out(i)))
+	}
+	return
+}
+
+func (g *typeGen) funcType(t reflect.Type, method bool) string {
+	params, rets := g.signature(t, method)
+	s := "fun(" + strings.Join(params, ", ") + ")"
+	if len(rets) > 0 { s += ": " + strings.Join(rets, ", ") }
+	return s
+}
+
+func (g *typeGen) global(name string, val any) {
+	if val == nil {
+		g.line(name + " = nil")
+		g.line("")
+		return
+	}
+
+	v := reflect.ValueOf(val)
+	t := v.Type()
+
+	switch {
+	case t.Kind() == reflect.Func:
+		params, rets := g.signature(t, false)
+		names := make([]string, len(params))
+		for i, param := range params {
+			pname, ptype, _ := strings.Cut(param, ": ")
+			names[i] = pname
+			g.line("---@param " + pname + " " + ptype)
+		}
+		for _, ret := range rets {
+			g.line("---@return " + ret)
+		}
+		g.line("function " + name + "(" + strings.Join(names, ", ") + ") end")
+
+	case t.Kind() == reflect.Map && t.Key().Kind() == reflect.String && t.Elem().Kind() == reflect.Interface:
+		// Maps of exposed values (e.g. NET, Input) are used as namespaces
+		g.line("---@class " + name)
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, key := range keys {
+			item := v.MapIndex(key).Elem()
+			if !item.IsValid() { continue }
+			g.line("---@field " + key.String() + " " + g.typeOf(item.Type()))
+		}
+		g.line(name + " = {}")
+
+	default:
+		g.line("---@type " + g.typeOf(t))
+		switch t.Kind() {
+		case reflect.Bool, reflect.String,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			g.line(name + " = " + fmt.Sprintf("%#v", v.Interface()))
+		default:
+			g.line(name + " = nil")
+		}
+	}
+
+	g.line("")
+}
+
+func (g *typeGen) class(t reflect.Type) {
+	name := g.seen[t]
+	if basic := basicType(t.Kind()); basic != "" {
+		g.line("---@class " + name + ": " + basic)
+	} else {
+		g.line("---@class " + name)
+	}
+
+	// Methods are called with ':', so the receiver becomes 'self'
+	method := func(m reflect.Method, has_receiver bool) {
+		params, rets := g.signature(m.Type, has_receiver)
+		params = append([]string{"self: " + name}, params...)
+		s := "fun(" + strings.Join(params, ", ") + ")"
+		if len(rets) > 0 { s += ": " + strings.Join(rets, ", ") }
+		g.line("---@field " + m.Name + " " + s)
+	}
+
+	if t.Kind() == reflect.Interface {
+		for i := 0; i < t.NumMethod(); i++ {
+			method(t.Method(i), false)
+		}
+		g.line("")
+		return
+	}
+
+	if t.Kind() == reflect.Struct {
+		for _, f := range reflect.VisibleFields(t) {
+			if !f.IsExported() || f.Anonymous { continue }
+			g.line("---@field " + f.Name + " " + g.typeOf(f.Type))
+		}
+	}
+
+	pt := reflect.PointerTo(t)
+	for i := 0; i < pt.NumMethod(); i++ {
+		method(pt.Method(i), true)
+	}
+
+	g.line("")
+}
@@ -15,6 +15,11 @@ import (
 	"github.com/glupi-borna/soko/internal/format"
 )
 
+type Exposer interface {
+	// Exposes a named value to the widget environment
+	Expose(name string, val any)
+}
+
 type Widget interface {
 	// Returns the name of the widget
 	Name()    string
@@ -25,8 +30,7 @@ type Widget interface {
 	// Returns a string that describes the type of widget (e.g. "lua")
 	Type()    string
 
-	// Exposes a named value to the widget environment
-	Expose(name string, val any)
+	Exposer
 
 	// Gets called once, after the window is created and the UI and other systems
 	// are initialized. Can be called internally for purposes of hotreload & similar.
@@ -36,6 +40,11 @@ type Widget interface {
 	// the UI and performing logic.
 	Frame()   error
 
+	// Gets called once per frame, after the frame is rendered. Used for work
+	// that has to happen between frames (e.g. evaluating code sent from an
+	// attached REPL).
+	Idle()    error
+
 	// Gets called once at application exit. Can be called internally for purposes
 	// of hotreload & similar.
 	Cleanup() error
@@ -66,6 +75,7 @@ func FindWidgets() ([]Widget, error) {
 
 		filename := item.Name()
 		if !strings.HasPrefix(filename, "soko_") { continue }
+		if IsTestFile(filename) { continue }
 
 		ext := path.Ext(filename)
 		if !ExtSupported(ext) { continue }
@@ -80,6 +90,19 @@ func FindWidgets() ([]Widget, error) {
 	return out, nil
 }
 
+// Test companion files are named like widget files, with a
+// '_test' suffix (e.g. soko_volume_test.lua for soko_volume.lua).
+func IsTestFile(filename string) bool {
+	name := strings.TrimPrefix(filename, "soko_")
+	name = name[:len(name)-len(path.Ext(name))]
+	return strings.HasSuffix(name, "_test")
+}
+
+func TestPath(w Widget) string {
+	ext := path.Ext(w.Path())
+	return w.Path()[:len(w.Path())-len(ext)] + "_test" + ext
+}
+
 func Load(name string) (Widget, error) {
 	all_widgets, err := FindWidgets()
 	if err != nil { return nil, err }
@@ -93,16 +116,38 @@ func Load(name string) (Widget, error) {
 	return nil, errors.New("Widget '" + name + "' not found!")
 }
 
-func ExposeEnvironment(w Widget) {
+// Menu icons are given by name, and looked up in the icon theme.
+func resolveMenuIcons(items []ui.MenuItem) {
+	for i := range items {
+		if items[i].Icon != "" { items[i].Icon = system.GetIconPath(items[i].Icon) }
+		resolveMenuIcons(items[i].Items)
+	}
+}
+
+func ExposeEnvironment(w Exposer) {
 	w.Expose("UI", func() *ui.UI_State { return ui.CurrentUI })
 	w.Expose("TextButton", ui.TextButton)
 	w.Expose("Text", ui.Text)
 	w.Expose("Animate", ui.Animate)
 	w.Expose("Column", ui.Column)
 	w.Expose("Row", ui.Row)
+	w.Expose("Wrap", ui.Wrap)
+	w.Expose("Grid", ui.Grid)
+	w.Expose("Stack", ui.Stack)
+	w.Expose("Float", ui.Float)
+	w.Expose("PositionFlow", ui.P_FLOW)
+	w.Expose("PositionAbsolute", ui.P_ABSOLUTE)
+	w.Expose("Cell", ui.Cell)
+	w.Expose("CellSpan", ui.CellSpan)
 	w.Expose("Button", ui.Button)
 	w.Expose("Slider", ui.Slider)
 	w.Expose("VSlider", ui.VSlider)
+	w.Expose("TextInput", ui.TextInput)
+	w.Expose("TextArea", ui.TextArea)
+	w.Expose("Checkbox", ui.Checkbox)
+	w.Expose("Toggle", ui.Toggle)
+	w.Expose("RadioGroup", ui.RadioGroup)
+	w.Expose("Select", ui.Select)
 	w.Expose("Invisible", ui.Invisible)
 	w.Expose("Col", ui.Col)
 	w.Expose("RGBA", func (r, g, b, a uint8) sdl.Color { return sdl.Color{r, g, b, a} })
@@ -111,6 +156,7 @@ func ExposeEnvironment(w Widget) {
 	w.Expose("Px", ui.Px)
 	w.Expose("Em", ui.Em)
 	w.Expose("Auto", ui.Auto)
+	w.Expose("Percent", ui.Percent)
 	w.Expose("ChildrenSize", ui.ChildrenSize)
 	w.Expose("LargestSibling", ui.LargestSibling)
 	w.Expose("FitText", ui.FitText)
@@ -118,16 +164,37 @@ func ExposeEnvironment(w Widget) {
 	w.Expose("Padding", ui.Padding)
 	w.Expose("Padding1", ui.Padding1)
 	w.Expose("Padding2", ui.Padding2)
+	w.Expose("Gap", ui.Gap)
+	w.Expose("Gap1", ui.Gap1)
+	w.Expose("Gap2", ui.Gap2)
 	w.Expose("Tick", ui.Tick)
 	w.Expose("Pulse", ui.Pulse)
 	w.Expose("NodeState", ui.NodeStateAny)
+	w.Expose("Key", ui.Key)
+	w.Expose("PushID", ui.PushID)
+	w.Expose("PopID", ui.PopID)
+	w.Expose("Focus", ui.Focus)
+	w.Expose("AutoFocus", ui.AutoFocus)
+	w.Expose("StateStats", ui.Stats)
+	w.Expose("SetStateTTL", func(frames uint64) { ui.CurrentUI.StateTTL = frames })
 	w.Expose("Marquee", ui.Marquee)
 	w.Expose("Image", ui.Image)
+	w.Expose("RichText", ui.RichText)
+	w.Expose("RichMarkup", ui.RichMarkup)
+	w.Expose("ParseMarkup", ui.ParseMarkup)
 
+	w.Expose("AlignAuto", ui.A_AUTO)
 	w.Expose("AlignStart", ui.A_START)
 	w.Expose("AlignCenter", ui.A_CENTER)
 	w.Expose("AlignEnd", ui.A_END)
 
+	w.Expose("JustifyStart", ui.J_START)
+	w.Expose("JustifyCenter", ui.J_CENTER)
+	w.Expose("JustifyEnd", ui.J_END)
+	w.Expose("JustifySpaceBetween", ui.J_SPACE_BETWEEN)
+	w.Expose("JustifySpaceAround", ui.J_SPACE_AROUND)
+	w.Expose("JustifySpaceEvenly", ui.J_SPACE_EVENLY)
+
 	w.Expose("ScrollBegin", ui.ScrollBegin)
 	w.Expose("ScrollEnd", ui.ScrollEnd)
 
@@ -138,6 +205,16 @@ func ExposeEnvironment(w Widget) {
 		return val
 	})
 
+	// Calls the callback of the activated item, and returns its ID
+	w.Expose("ContextMenu", func (target *ui.Node, items []ui.MenuItem) string {
+		resolveMenuIcons(items)
+		item := ui.ContextMenu(target, items)
+		if item == nil { return "" }
+		if item.Callback != nil { item.Callback() }
+		return item.ID
+	})
+
+	for key, val := range ui.WidgetVars { w.Expose(key, val) }
 	for key, val := range sound.WidgetVars { w.Expose(key, val) }
 	for key, val := range player.WidgetVars { w.Expose(key, val) }
 	for key, val := range system.WidgetVars { w.Expose(key, val) }
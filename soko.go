@@ -18,8 +18,6 @@ import (
 	"github.com/glupi-borna/soko/internal/globals"
 )
 
-var widget_name string
-
 var no_profile = false
 var profile *bool = &no_profile
 
@@ -44,10 +42,19 @@ var window_y = flag.Int(
 
 var window_anchor WindowAnchorFlag
 
+var test_format = flag.String(
+	"format", "tap",
+	"Output format of 'soko test' results (tap or go).")
+
 func UsageHandler() {
 	b := strings.Builder{}
-	b.WriteString("Usage: soko [options] widget_name\n")
+	b.WriteString("Usage: soko [options] widget_name [widget_options] [widget_name [widget_options]...]\n")
+	b.WriteString("       soko [options] test widget_name\n")
+	b.WriteString("       soko attach widget_name\n")
+	b.WriteString("       soko gen-types > soko.d.lua\n")
 	b.WriteString("options:\n")
+	b.WriteString("(-x, -y, -anchor and -display can also be given after a widget name,\n")
+	b.WriteString(" to apply only to that widget)\n")
 
 	flag.VisitAll(func (f *flag.Flag) {
 		b.WriteString("\n-")
@@ -81,7 +88,21 @@ func main() {
 
 	flag.Parse()
 
-	if flag.NArg() != 1 {
+	if flag.NArg() == 1 && flag.Arg(0) == "gen-types" {
+		Die(widget.GenTypes(os.Stdout))
+		return
+	}
+
+	if flag.NArg() == 2 && flag.Arg(0) == "attach" {
+		Die(widget.Attach(flag.Arg(1), os.Stdin, os.Stdout))
+		return
+	}
+
+	if flag.NArg() == 2 && flag.Arg(0) == "test" {
+		os.Exit(runTests(flag.Arg(1)))
+	}
+
+	if flag.NArg() < 1 {
 		println("Widget name not provided!")
 		flag.Usage()
 		os.Exit(1)
@@ -96,112 +117,230 @@ func main() {
 		}()
 	}
 
-	widget_name = flag.Arg(0)
+	specs, err := parseWidgetArgs(flag.Args())
+	if err != nil {
+		println(err.Error())
+		flag.Usage()
+		os.Exit(1)
+	}
 
-	w, err := widget.Load(widget_name)
-	Die(err)
+	instances := make([]*instance, 0, len(specs))
+	for _, spec := range specs {
+		w, err := widget.Load(spec.name)
+		Die(err)
+		instances = append(instances, &instance{widget: w, running: true})
+	}
 
 	runtime.LockOSThread()
+	defer initSDL()()
 
-	err = sdl.Init(sdl.INIT_EVERYTHING)
-	Die(err)
-	defer sdl.Quit()
+	// Close() is only called from widget code, so it
+	// closes the widget whose frame is being built.
+	var current *instance
+	globals.Close = func () {
+		if current != nil { current.running = false }
+	}
 
-	err = ttf.Init()
-	Die(err)
-	defer ttf.Quit()
+	by_id := make(map[uint32]*instance, len(instances))
 
-	err = img.Init(img.INIT_JPG | img.INIT_PNG | img.INIT_WEBP | img.INIT_TIF)
-	Die(err)
-	defer img.Quit()
-
-	running := true
-	Platform.Init(PlatformInitOptions{
-		X: int32(*window_x),
-		Y: int32(*window_y),
-		Anchor: window_anchor,
-		Display: *display,
-	})
-	globals.Close = func () { running = false }
-
-	UI := MakeUI()
+	for i, inst := range instances {
+		inst.platform = &Platform_State{}
+		Platform = inst.platform
+		Platform.Init(specs[i].opts)
+		by_id[Platform.WindowID()] = inst
 
-	err = w.Init()
-	Die(err)
-	defer func() { Die(w.Cleanup()) }()
+		inst.ui = MakeUI()
+		current = inst
+		Die(inst.widget.Init())
+	}
+	current = nil
 
-	Platform.Window.Show()
+	defer func() {
+		for _, inst := range instances { inst.cleanup() }
+	}()
 
-	last_err_text := ""
+	for _, inst := range instances {
+		inst.platform.Window.Show()
+	}
 
-	for running {
-		if *timeout > 0 && uint64(UI.LastFrameStart.Milliseconds()) > *timeout { running = false }
+	// Text input (and input method) events are needed by TextInput
+	sdl.StartTextInput()
+	defer sdl.StopTextInput()
 
-		ButtonMapUpdate(Platform.Keyboard)
-		ButtonMapUpdate(Platform.Mouse)
-		Platform.AnyKeyPressed = false
-		Platform.MouseDelta.X = 0
-		Platform.MouseDelta.Y = 0
-		Platform.WheelDelta.X = 0
-		Platform.WheelDelta.Y = 0
+	for len(instances) > 0 {
+		for _, inst := range instances {
+			inst.platform.ResetInput()
+		}
 
 		for event := sdl.PollEvent() ; event != nil ; event = sdl.PollEvent() {
 			switch e := event.(type) {
-
-			case *sdl.MouseButtonEvent:
-				if e.Type == sdl.MOUSEBUTTONDOWN {
-					Platform.Mouse[e.Button] = BS_PRESSED
-				} else {
-					Platform.Mouse[e.Button] = BS_RELEASED
-				}
-				Platform.MousePos.X = float32(e.X)
-				Platform.MousePos.Y = float32(e.Y)
-
-			case *sdl.MouseWheelEvent:
-				Platform.WheelDelta.X += float32(e.X)
-				Platform.WheelDelta.Y += float32(e.Y)
-
-			case *sdl.MouseMotionEvent:
-				Platform.MousePos.X = float32(e.X)
-				Platform.MousePos.Y = float32(e.Y)
-				Platform.MouseDelta.X += float32(e.XRel)
-				Platform.MouseDelta.Y += float32(e.YRel)
-
-			case *sdl.KeyboardEvent:
-				if e.Type == sdl.KEYDOWN {
-					Platform.Keyboard[uint32(e.Keysym.Scancode)] = BS_PRESSED
-					Platform.AnyKeyPressed = true
-				} else {
-					Platform.Keyboard[uint32(e.Keysym.Scancode)] = BS_RELEASED
-				}
-
 			case *sdl.QuitEvent:
-				running = false
-				break
+				for _, inst := range instances { inst.running = false }
+			case *sdl.WindowEvent:
+				if e.Event == sdl.WINDOWEVENT_CLOSE {
+					inst, ok := by_id[e.WindowID]
+					if ok { inst.running = false }
+				}
+			default:
+				id, ok := EventWindowID(event)
+				if !ok { continue }
+				inst, ok := by_id[id]
+				if ok { inst.platform.HandleEvent(event) }
 			}
 		}
 
 		millis := sdl.GetTicks64()
 
-		UI.Begin(millis); {
-			err := w.Frame()
-			if err != nil {
-				if err.Error() != last_err_text {
-					last_err_text = err.Error()
-					println(err.Error())
-				}
-				UI.Root.Children = nil
-				UI.Current = UI.Root
-				UI.Root.Style = DefaultStyle.Copy()
-				UI.Root.Style.Background = StyleVar(ColHex(0xff0000ff))
-				WithNode(Column(), func(n *Node) {
-					Text("Error in " + w.Name())
-					Text("Check output for trace")
-				})
+		for _, inst := range instances {
+			if !inst.running { continue }
+			current = inst
+			inst.frame(millis)
+		}
+		current = nil
+
+		if *timeout > 0 && millis > *timeout {
+			for _, inst := range instances { inst.running = false }
+		}
+
+		open := instances[:0]
+		for _, inst := range instances {
+			if inst.running {
+				open = append(open, inst)
+			} else {
+				delete(by_id, inst.platform.WindowID())
+				inst.cleanup()
+			}
+		}
+		instances = open
+	}
+}
+
+type widgetSpec struct {
+	name string
+	opts PlatformInitOptions
+}
+
+// Splits the positional arguments into widget names, each optionally
+// followed by its own placement options (e.g. 'volume -x 10 media -x -10').
+// Placement options default to the ones given before the first widget.
+func parseWidgetArgs(args []string) ([]widgetSpec, error) {
+	specs := []widgetSpec{}
+
+	for len(args) > 0 {
+		name := args[0]
+		anchor := window_anchor
+
+		fs := flag.NewFlagSet(name, flag.ContinueOnError)
+		x := fs.Int("x", *window_x, "")
+		y := fs.Int("y", *window_y, "")
+		d := fs.Int("display", *display, "")
+		fs.Var(&anchor, "anchor", "")
+
+		err := fs.Parse(args[1:])
+		if err != nil { return nil, err }
+
+		specs = append(specs, widgetSpec{
+			name: name,
+			opts: PlatformInitOptions{
+				X: int32(*x),
+				Y: int32(*y),
+				Anchor: anchor,
+				Display: *d,
+			},
+		})
+		args = fs.Args()
+	}
+
+	return specs, nil
+}
+
+// A widget running in its own window.
+type instance struct {
+	widget widget.Widget
+	platform *Platform_State
+	ui *UI_State
+	running bool
+	last_err_text string
+}
+
+func (inst *instance) frame(millis uint64) {
+	Platform = inst.platform
+	UI := inst.ui
+	w := inst.widget
+
+	UI.Begin(millis); {
+		err := w.Frame()
+		if err != nil {
+			if err.Error() != inst.last_err_text {
+				inst.last_err_text = err.Error()
+				println(err.Error())
 			}
-		} ; UI.End()
-		UI.Render()
+			UI.Root.Children = nil
+			UI.Current = UI.Root
+			UI.Root.Style = DefaultStyle.Copy()
+			UI.Root.Style.Background = StyleVar(ColHex(0xff0000ff))
+			WithNode(Column(), func(n *Node) {
+				Text("Error in " + w.Name())
+				Text("Check output for trace")
+			})
+		}
+	} ; UI.End()
+	UI.Render()
+
+	err := w.Idle()
+	if err != nil { println(err.Error()) }
+}
+
+func (inst *instance) cleanup() {
+	if inst.platform == nil { return }
+	Platform = inst.platform
+	CurrentUI = inst.ui
+	Die(inst.widget.Cleanup())
+	inst.platform.Cleanup()
+	inst.platform = nil
+}
+
+// Initializes SDL and its extensions, and returns
+// a function that shuts them down.
+func initSDL() func() {
+	err := sdl.Init(sdl.INIT_EVERYTHING)
+	Die(err)
+
+	err = ttf.Init()
+	Die(err)
+
+	err = img.Init(img.INIT_JPG | img.INIT_PNG | img.INIT_WEBP | img.INIT_TIF)
+	Die(err)
+
+	return func() {
+		img.Quit()
+		ttf.Quit()
+		sdl.Quit()
+	}
+}
+
+// Runs the widget's companion test file headlessly.
+// Returns the process exit code.
+func runTests(name string) int {
+	os.Setenv("SDL_VIDEODRIVER", "dummy")
+	os.Setenv("SDL_AUDIODRIVER", "dummy")
+
+	w, err := widget.Load(name)
+	Die(err)
+
+	runtime.LockOSThread()
+	defer initSDL()()
+
+	Platform.Init(PlatformInitOptions{Headless: true})
+	globals.Close = func() {}
+
+	failed, err := widget.RunTests(w, os.Stdout, *test_format)
+	if err != nil {
+		println(err.Error())
+		return 1
 	}
+	if failed > 0 { return 1 }
+	return 0
 }
 
 func PrintTree(n *Node, indent string) {
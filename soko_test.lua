@@ -27,10 +27,9 @@ function PlayerControls()
 
     for row in With(Row()) do
         row.Size.W = ChildrenSize()
+        row.Gap = Gap(4)
         if IconButton("media-skip-backward-symbolic") then player:Previous() end
-        Invisible(Em(.25))
         if IconButton(icon) then player:PlayPause() end
-        Invisible(Em(.25))
         if IconButton("media-skip-forward-symbolic") then player:Next() end
     end
 end
@@ -92,6 +91,12 @@ function SongInfo()
     end
 end
 
+local filter = ""
+local loop = "None"
+local items = {"First Hello is really long so that we have to scroll horizontally and stuff"}
+for i = 1, 18 do table.insert(items, "Hello") end
+table.insert(items, "Last Hello")
+
 function frame()
     local root = UI().Root
     root.Style.Font = "Ubuntu"
@@ -106,47 +111,50 @@ function frame()
 
         for col in With(Column()) do
             col.Padding = Padding(0)
+            col.Gap = Gap(4)
             col.Size.W = ChildrenSize()
             col.Size.H = ChildrenSize()
-            local volume = Volume()
-            local old_vol = volume
-            volume, slider = VSlider(volume, 0, 1)
+            local volume, slider, changed = VSlider(Volume(), 0, 1, 0.05)
             slider.Style = root.Style:Copy()
             slider.Style.Align = AlignCenter
             slider.Size.W = Px(12)
             slider.Size.H = Em(8)
-            if volume ~= old_vol then SetVolume(volume) end
-
-            Invisible(Em(.25))
+            if changed then SetVolume(volume) end
+
+            local action = ContextMenu(slider, {
+                {ID = "mute", Label = "Mute", Checkable = true, Checked = IsMuted()},
+                {Separator = true},
+                {Label = "Volume", Items = {
+                    {ID = "volume-50", Label = "50%"},
+                    {ID = "volume-100", Label = "100%"},
+                }},
+                {ID = "boost", Label = "Boost", Disabled = true},
+            })
+            if action == "mute" then SetMute(not IsMuted()) end
+            if action == "volume-50" then SetVolume(0.5) end
+            if action == "volume-100" then SetVolume(1) end
 
             local icon = "audio-volume-high-symbolic"
             if IsMuted() then icon = "audio-volume-muted-symbolic" end
             IconButton(icon)
+
+            local muted, _, mute_changed = Toggle(IsMuted())
+            if mute_changed then SetMute(muted) end
         end
 
         SongInfo()
     end
 
+    filter = TextInput(filter, {Placeholder = "Filter"})
+    Shortcut("m", function() SetMute(not IsMuted()) end)
+    Shortcut("Escape", function() filter = "" end)
+    loop = Select({"None", "Track", "Playlist"}, loop)
+
     local scroller = ScrollBegin()
-        Text("First Hello is really long so that we have to scroll horizontally and stuff")
-        Text("Hello")
-        Text("Hello")
-        Text("Hello")
-        Text("Hello")
-        Text("Hello")
-        Text("Hello")
-        Text("Hello")
-        Text("Hello")
-        Text("Hello")
-        Text("Hello")
-        Text("Hello")
-        Text("Hello")
-        Text("Hello")
-        Text("Hello")
-        Text("Hello")
-        Text("Hello")
-        Text("Hello")
-        Text("Hello")
-        Text("Last Hello")
+    scroller:State().Scrollbars = true
+    scroller:State().DragPan = true
+        for _, item in ipairs(items) do
+            if filter == "" or string.find(item, filter, 1, true) then Text(item) end
+        end
     ScrollEnd()
 end
@@ -0,0 +1,192 @@
+Mock("Volume", 0.5)
+Mock("IsMuted", false)
+Mock("SetVolume")
+Mock("SetMute")
+Mock("Players", {}, nil)
+
+Test("scroll window contains all items", function()
+    Frames(2)
+    Assert(Find("First Hello is really long so that we have to scroll horizontally and stuff") ~= nil)
+    Assert(Find("Last Hello") ~= nil, "last item is missing")
+end)
+
+Test("volume slider has the requested size", function()
+    Frames(2)
+    local slider = Find("root.row0.column0.vslider0")
+    Assert(slider ~= nil, "volume slider is missing")
+    AssertEq(slider.RealSize.X, 12 + slider.Padding.Left + slider.Padding.Right, "slider width")
+end)
+
+Test("dragging the volume slider sets the volume", function()
+    Frames(2)
+    local slider = Find("root.row0.column0.vslider0")
+    MoveMouse(slider.Pos.X + slider.RealSize.X/2, slider.Pos.Y + slider.RealSize.Y/4)
+    MouseDown()
+    Frames(2)
+    MouseUp()
+
+    local calls = Calls("SetVolume")
+    Assert(#calls > 0, "SetVolume was not called")
+    Assert(calls[#calls][1] > 0.5, "volume was not increased")
+end)
+
+Test("tab and arrow keys move focus between the controls", function()
+    Frames(2)
+    Press("Tab")
+    AssertEq(UI().Focus, "root.row0.column0.vslider0")
+    Press("Tab")
+    AssertEq(UI().Focus, "root.row0.column0.button0")
+    Press("Up")
+    AssertEq(UI().Focus, "root.row0.column0.vslider0")
+    Press("Shift+Tab")
+    AssertEq(UI().Focus, "root.select0")
+end)
+
+Test("the volume slider steps with the keyboard and the wheel", function()
+    Frames(2)
+    Press("Tab")
+    Press("Up")
+    local calls = Calls("SetVolume")
+    AssertEq(#calls, 1, "SetVolume calls")
+    Assert(math.abs(calls[1][1] - 0.55) < 0.001, "volume did not step up")
+    AssertEq(UI().Focus, "root.row0.column0.vslider0", "focus after Up")
+
+    local slider = Find("root.row0.column0.vslider0")
+    MoveMouse(slider.Pos.X + slider.RealSize.X/2, slider.Pos.Y + slider.RealSize.Y/2)
+    Scroll(0, -2)
+    Frames(1)
+    calls = Calls("SetVolume")
+    Assert(calls[#calls][1] < 0.5, "volume was not decreased")
+end)
+
+Test("the focused scroll window scrolls with the keyboard", function()
+    Frames(1)
+    NodeState(Find("root.scroll_window0")).Focusable = true
+    Frames(1)
+    Press("Shift+Tab")
+    AssertEq(UI().Focus, "root.scroll_window0")
+
+    local state = NodeState(Find("root.scroll_window0"))
+    Assert(state.MaxOffset.Y > 0, "scroll window does not overflow")
+    Press("End")
+    AssertEq(state.TargetOffset.Y, -state.MaxOffset.Y, "offset after End")
+    Press("Up")
+    Assert(math.abs(state.TargetOffset.Y - (40 - state.MaxOffset.Y)) < 0.01, "Up did not scroll up")
+    Press("Home")
+    AssertEq(state.TargetOffset.Y, 0, "offset after Home")
+end)
+
+Test("dragging the scrollbar scrolls the content", function()
+    Frames(2)
+    local window = Find("root.scroll_window0")
+    local x = window.Pos.X + window.RealSize.X - 4
+    MoveMouse(x, window.Pos.Y + 4)
+    MouseDown()
+    MoveMouse(x, window.Pos.Y + window.RealSize.Y)
+    MouseUp()
+
+    local state = NodeState(window)
+    AssertEq(state.TargetOffset.Y, -state.MaxOffset.Y, "offset after dragging")
+end)
+
+Test("typing into the filter hides items that do not match", function()
+    Frames(2)
+    Click("root.text_input0")
+    AssertEq(UI().Focus, "root.text_input0")
+    Type("Last")
+    Frames(1)
+    Assert(Find("Last Hello") ~= nil, "matching item is missing")
+    Assert(Find("Hello") == nil, "item that does not match is shown")
+
+    Press("Ctrl+A")
+    Press("Backspace")
+    Assert(Find("Hello") ~= nil, "items are not shown after clearing the filter")
+    Press("Ctrl+Z")
+    Assert(Find("Hello") == nil, "undo did not restore the filter")
+end)
+
+Test("shortcuts that type text are ignored while a text input has the focus", function()
+    Frames(2)
+    Press("m")
+    AssertEq(#Calls("SetMute"), 1, "SetMute calls from the shortcut")
+
+    Click("root.text_input0")
+    Type("Last")
+    Press("m")
+    AssertEq(#Calls("SetMute"), 1, "SetMute calls while typing")
+    Assert(Find("Hello") == nil, "item that does not match is shown")
+    Press("Escape")
+    Assert(Find("Hello") ~= nil, "Escape did not clear the filter")
+end)
+
+Test("the mute toggle switches with a click and with Space", function()
+    Frames(2)
+    Click("root.row0.column0.toggle0")
+    local calls = Calls("SetMute")
+    AssertEq(#calls, 1, "SetMute calls")
+    AssertEq(calls[1][1], true, "mute after click")
+    AssertEq(UI().Focus, "root.row0.column0.toggle0")
+
+    Press("Space")
+    AssertEq(#Calls("SetMute"), 2, "SetMute calls after Space")
+end)
+
+Test("the loop select picks options with the mouse and the keyboard", function()
+    Frames(2)
+    Click("root.select0")
+    Assert(Find("Track") ~= nil, "list did not open")
+    Click("Track")
+    Frames(1)
+    Assert(Find("None") == nil, "list did not close")
+    Assert(Find("Track") ~= nil, "clicked option was not picked")
+    AssertEq(UI().Focus, "root.select0")
+
+    Press("Space")
+    Press("Down")
+    Press("Return")
+    Frames(1)
+    Assert(Find("Playlist") ~= nil, "Down and Return did not pick the next option")
+    Assert(Find("Track") == nil, "list did not close")
+
+    Press("Space")
+    Assert(Find("None") ~= nil, "Space did not open the list")
+    Press("Escape")
+    Assert(Find("None") == nil, "Escape did not close the list")
+end)
+
+Test("the volume context menu runs the picked item and opens submenus on hover", function()
+    Frames(2)
+    Click("root.row0.column0.vslider0", "right")
+    Assert(Find("Mute") ~= nil, "menu did not open")
+    Click("Boost")
+    Assert(Find("Mute") ~= nil, "clicking a disabled item closed the menu")
+    Click("Mute")
+    AssertEq(#Calls("SetMute"), 1, "SetMute calls")
+    Frames(1)
+    Assert(Find("Mute") == nil, "menu did not close")
+
+    Click("root.row0.column0.vslider0", "right")
+    MoveTo("Volume")
+    Frames(1)
+    Assert(Find("100%") ~= nil, "submenu did not open on hover")
+    Click("100%")
+    local calls = Calls("SetVolume")
+    AssertEq(calls[#calls][1], 1, "volume from the submenu")
+end)
+
+Test("the context menu works with the keyboard", function()
+    Frames(2)
+    Press("Tab")
+    AssertEq(UI().Focus, "root.row0.column0.vslider0")
+    Press("Shift+F10")
+    Assert(Find("Mute") ~= nil, "menu did not open")
+    Press("Down")
+    Press("Right")
+    Assert(Find("50%") ~= nil, "Right did not open the submenu")
+    Press("Return")
+    local calls = Calls("SetVolume")
+    AssertEq(calls[#calls][1], 0.5, "volume from the submenu")
+    Frames(1)
+    Assert(Find("Mute") == nil, "menu did not close")
+    AssertEq(UI().Focus, "root.row0.column0.vslider0", "focus after closing")
+end)
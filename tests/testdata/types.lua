@@ -0,0 +1,34 @@
+---@meta
+-- Generated by 'soko gen-types', do not edit.
+
+---@type integer
+Count = 3
+
+---@param ... tests.Point
+---@return tests.Path
+---@return error
+function MakePath(...) end
+
+---@type tests.Point
+Origin = nil
+
+---@class Shapes
+---@field Modes tests.Mode[]
+---@field Point tests.Point
+Shapes = {}
+
+---@class tests.Point
+---@field X number
+---@field Y number
+---@field Mode tests.Mode
+---@field Move fun(self: tests.Point, arg1: number, arg2: number): tests.Point
+
+---@class tests.Path
+---@field Last fun(self: tests.Path): tests.Point, boolean
+
+---@class error
+---@field Error fun(self: error): string
+
+---@class tests.Mode: integer
+---@field Next fun(self: tests.Mode): tests.Mode
+
@@ -0,0 +1,49 @@
+package test
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"github.com/glupi-borna/soko/internal/widget"
+)
+
+type Mode int
+
+func (m Mode) Next() Mode { return m + 1 }
+
+type Point struct {
+	X, Y   float32
+	Mode   Mode
+	hidden bool
+}
+
+func (p *Point) Move(dx, dy float32) *Point {
+	p.X += dx
+	p.Y += dy
+	return p
+}
+
+type Path []Point
+
+func (p Path) Last() (Point, bool) {
+	if len(p) == 0 { return Point{}, false }
+	return p[len(p)-1], true
+}
+
+func exposeFixture(e widget.Exposer) {
+	e.Expose("Origin", &Point{})
+	e.Expose("MakePath", func(points ...Point) (Path, error) { return points, nil })
+	e.Expose("Count", 3)
+	e.Expose("Shapes", map[string]any{"Point": &Point{}, "Modes": []Mode{}})
+}
+
+// Compares the annotations generated for the fixture with testdata/types.lua.
+func TestWriteTypes(t *testing.T) {
+	golden, err := os.ReadFile("testdata/types.lua")
+	if err != nil { t.Fatal(err) }
+
+	out := strings.Builder{}
+	err = widget.WriteTypes(&out, exposeFixture)
+	if err != nil { t.Fatal(err) }
+	AssertEq(out.String(), string(golden), t)
+}
@@ -1,3 +1,7 @@
+// Black-box tests and the assertion helpers shared by all tests.
+// Tests that need unexported internals (e.g. the layout passes in
+// internal/ui) live next to the code and import this package only
+// for the helpers.
 package test
 
 import (